@@ -0,0 +1,163 @@
+package go_base_api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// InternalAuthConfig protects the internal routes (/env, /info, /prometheus).
+// Without keys, users and CIDRs the routes stay open.
+type InternalAuthConfig struct {
+	APIKeyHeader string            `json:"api_key_header" yaml:"api_key_header"`
+	APIKeys      []string          `json:"-" yaml:"api_keys"`
+	BasicUsers   map[string]string `json:"-" yaml:"basic_users"`
+	AllowedCIDRs []string          `json:"allowed_cidrs" yaml:"allowed_cidrs"`
+}
+
+func (c InternalAuthConfig) credentialsRequired() bool {
+	return len(c.APIKeys) > 0 || len(c.BasicUsers) > 0
+}
+
+// parseCIDRs parses CIDRs and plain IPs, logging invalid entries.
+func parseCIDRs(list []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil {
+				bits := 128
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			Log.Errorf("Cannot parse CIDR %q: %v", s, err)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is only used
+// when the connection comes from one of TrustedProxies, and is read from the
+// right skipping trusted hops.
+func (a *API) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(a.trustedProxies, ip) {
+		return host
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		hopIP := net.ParseIP(hop)
+		if hopIP == nil {
+			break
+		}
+		host = hop
+		if !containsIP(a.trustedProxies, hopIP) {
+			break
+		}
+	}
+	return host
+}
+
+// matchSecret compares presented with stored in constant time. A stored value
+// prefixed with "sha256:" is the hex SHA-256 of the secret.
+func matchSecret(stored, presented string) bool {
+	if strings.HasPrefix(stored, "sha256:") {
+		sum := sha256.Sum256([]byte(presented))
+		presented = hex.EncodeToString(sum[:])
+		stored = strings.ToLower(strings.TrimPrefix(stored, "sha256:"))
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(presented)) == 1
+}
+
+func (a *API) internalAuthenticated(r *http.Request) bool {
+	conf := a.Config.InternalAuth
+	if key := r.Header.Get(conf.APIKeyHeader); key != "" {
+		for _, k := range conf.APIKeys {
+			if matchSecret(k, key) {
+				return true
+			}
+		}
+	}
+	if user, pass, ok := r.BasicAuth(); ok {
+		if stored, found := conf.BasicUsers[user]; found && matchSecret(stored, pass) {
+			return true
+		}
+	}
+	return false
+}
+
+// InternalAccess guards internal routes with the IP allowlist, API key and
+// basic auth from InternalAuth. Denied requests get 403 (address) or 401
+// (credentials) in the standard error envelope.
+func (a *API) InternalAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(a.internalNets) > 0 {
+			ip := net.ParseIP(a.ClientIP(req))
+			if ip == nil || !containsIP(a.internalNets, ip) {
+				a.Error(w, req, &APIError{Status: http.StatusForbidden, Detail: fmt.Sprintf("address %s is not allowed", a.ClientIP(req)), Err: ErrForbidden})
+				return
+			}
+		}
+		if a.Config.InternalAuth.credentialsRequired() && !a.internalAuthenticated(req) {
+			if len(a.Config.InternalAuth.BasicUsers) > 0 {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q`, a.Config.App))
+			}
+			a.Error(w, req, &APIError{Status: http.StatusUnauthorized, Detail: "valid credentials are required", Err: ErrUnauthorized})
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// internalAccessPolicy marks the routes wrapped by InternalAccess in
+// RoutePolicies.
+const internalAccessPolicy = "internal_access"
+
+// internalRoute reports whether req matched a route guarded by
+// InternalAccess. The authenticators of Router leave those routes to it.
+func (a *API) internalRoute(req *http.Request) bool {
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return contains(a.policies[route], internalAccessPolicy)
+}
+
+// InitializeAccess parses TrustedProxies and the InternalAuth allowlist.
+func (a *API) InitializeAccess() {
+	a.trustedProxies = parseCIDRs(a.Config.TrustedProxies)
+	a.internalNets = parseCIDRs(a.Config.InternalAuth.AllowedCIDRs)
+}
@@ -0,0 +1,234 @@
+package go_base_api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	AccessLogJSON     = "json"
+	AccessLogCombined = "combined"
+)
+
+// AccessLogConfig configures the access log written by API.Logging.
+// Levels and Sampling are keyed by status class ("2xx".."5xx") and by path
+// prefix or route name respectively.
+type AccessLogConfig struct {
+	Format   string             `json:"format" yaml:"format"`
+	Levels   map[string]string  `json:"levels" yaml:"levels"`
+	Sampling map[string]float64 `json:"sampling" yaml:"sampling"`
+}
+
+var defaultAccessLogLevels = map[string]logrus.Level{
+	"1xx": logrus.DebugLevel,
+	"2xx": logrus.DebugLevel,
+	"3xx": logrus.DebugLevel,
+	"4xx": logrus.WarnLevel,
+	"5xx": logrus.ErrorLevel,
+}
+
+// responseRecorder records the status code and body size written by a handler.
+type responseRecorder struct {
+	status      int
+	written     int64
+	wroteHeader bool
+}
+
+// recordResponse wraps w keeping its optional interfaces (Flusher, Hijacker, ...).
+func recordResponse(w http.ResponseWriter) (*responseRecorder, http.ResponseWriter) {
+	rec := &responseRecorder{status: http.StatusOK}
+	return rec, httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if !rec.wroteHeader {
+					rec.status = code
+					rec.wroteHeader = true
+				}
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				rec.wroteHeader = true
+				n, err := next(b)
+				rec.written += int64(n)
+				return n, err
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				rec.wroteHeader = true
+				n, err := next(src)
+				rec.written += n
+				return n, err
+			}
+		},
+	})
+}
+
+type ctxKeyAccessLog struct{}
+
+// accessLogFields collects fields added by handlers during a request.
+type accessLogFields struct {
+	mu     sync.Mutex
+	fields logrus.Fields
+}
+
+// SetAccessLogField adds key=value to the access log line of the request in
+// ctx, e.g. the authenticated user. It is a no-op outside API.Logging.
+func SetAccessLogField(ctx context.Context, key string, value interface{}) {
+	if f, ok := ctx.Value(ctxKeyAccessLog{}).(*accessLogFields); ok {
+		f.mu.Lock()
+		f.fields[key] = value
+		f.mu.Unlock()
+	}
+}
+
+// matchRoute reports whether the request path is one of rules or below it
+// (rules starting with "/", matched by whole segments so "/health" does not
+// cover "/healthcare") or its route is named like one of rules.
+func matchRoute(rules []string, path, routeName string) (string, bool) {
+	for _, rule := range rules {
+		if strings.HasPrefix(rule, "/") {
+			if path == rule || strings.HasPrefix(path, strings.TrimSuffix(rule, "/")+"/") {
+				return rule, true
+			}
+		} else if rule != "" && rule == routeName {
+			return rule, true
+		}
+	}
+	return "", false
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+func (a *API) accessLogLevel(status int) logrus.Level {
+	class := statusClass(status)
+	if name, ok := a.Config.AccessLog.Levels[class]; ok {
+		if level, err := logrus.ParseLevel(name); err == nil {
+			return level
+		}
+	}
+	if level, ok := defaultAccessLogLevels[class]; ok {
+		return level
+	}
+	return logrus.InfoLevel
+}
+
+// sampled applies AccessLog.Sampling to successful requests, errors are always logged.
+func (a *API) sampled(status int, path, routeName string) bool {
+	if status >= http.StatusBadRequest || len(a.Config.AccessLog.Sampling) == 0 {
+		return true
+	}
+	rules := make([]string, 0, len(a.Config.AccessLog.Sampling))
+	for rule := range a.Config.AccessLog.Sampling {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	rule, ok := matchRoute(rules, path, routeName)
+	if !ok {
+		return true
+	}
+	return rand.Float64() < a.Config.AccessLog.Sampling[rule]
+}
+
+// Logging writes an access log line per request with status, size, duration,
+// client and trace IDs, in JSON fields or Apache combined format. Requests
+// matching IgnoreLoggingRequest (path prefixes or route names) are logged at
+// Trace level.
+func (a *API) Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		extra := &accessLogFields{fields: logrus.Fields{}}
+		ctx := context.WithValue(req.Context(), ctxKeyAccessLog{}, extra)
+		rec, ww := recordResponse(w)
+		next.ServeHTTP(ww, req.WithContext(ctx))
+		duration := time.Since(start)
+
+		routeName := ""
+		if route := mux.CurrentRoute(req); route != nil {
+			routeName = route.GetName()
+		}
+		level := a.accessLogLevel(rec.status)
+		if _, ignored := matchRoute(a.Config.IgnoreLoggingRequest, req.URL.Path, routeName); ignored {
+			level = logrus.TraceLevel
+		} else if !a.sampled(rec.status, req.URL.Path, routeName) {
+			return
+		}
+		if !Log.IsLevelEnabled(level) {
+			return
+		}
+
+		extra.mu.Lock()
+		defer extra.mu.Unlock()
+		if a.Config.AccessLog.Format == AccessLogCombined {
+			user := "-"
+			// set by SetAccessLogField, or the caller found by JWTAuth or APIKeyAuth
+			for _, field := range []string{"user", "subject", "api_key"} {
+				if u, ok := extra.fields[field]; ok {
+					user = fmt.Sprint(u)
+					break
+				}
+			}
+			size := "-"
+			if rec.written > 0 {
+				size = fmt.Sprint(rec.written)
+			}
+			fmt.Fprintf(Log.Out, "%s - %s [%s] \"%s %s %s\" %d %s %q %q\n",
+				a.ClientIP(req), user, start.Format("02/Jan/2006:15:04:05 -0700"),
+				req.Method, req.RequestURI, req.Proto, rec.status, size, orDash(req.Referer()), orDash(req.UserAgent()))
+			return
+		}
+		fields := logrus.Fields{
+			"method":      req.Method,
+			"path":        req.URL.Path,
+			"status":      rec.status,
+			"bytes":       rec.written,
+			"duration_ms": float64(duration.Microseconds()) / 1000,
+			"remote_ip":   a.ClientIP(req),
+			"user_agent":  req.UserAgent(),
+			"proto":       req.Proto,
+		}
+		if tpl := routeTemplate(req); tpl != "" {
+			fields["route"] = tpl
+		}
+		if req.URL.RawQuery != "" {
+			fields["query"] = req.URL.RawQuery
+		}
+		if ref := req.Referer(); ref != "" {
+			fields["referer"] = ref
+		}
+		if id := RequestIDFrom(req.Context()); id != "" {
+			fields["request_id"] = id
+		}
+		if sc := oteltrace.SpanContextFromContext(req.Context()); sc.IsValid() {
+			fields["trace_id"] = sc.TraceID().String()
+			fields["span_id"] = sc.SpanID().String()
+		}
+		for k, v := range extra.fields {
+			fields[k] = v
+		}
+		Log.WithFields(fields).Logf(level, "%s %s %d", req.Method, req.URL.Path, rec.status)
+	})
+}
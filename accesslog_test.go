@@ -0,0 +1,31 @@
+package go_base_api
+
+import "testing"
+
+func TestMatchRoute(t *testing.T) {
+	rules := []string{"/health", "/swagger/", "/api/v1/orders", "export-report", ""}
+	for _, tt := range []struct {
+		path, name string
+		rule       string
+	}{
+		{"/health", "", "/health"},
+		{"/health/ready", "", "/health"},
+		{"/healthcare", "", ""},
+		{"/healthcare/records", "", ""},
+		{"/swagger/index.html", "", "/swagger/"},
+		{"/swagger", "", ""},
+		{"/swaggerui", "", ""},
+		{"/api/v1/orders/42", "", "/api/v1/orders"},
+		{"/api/v1/ordersx", "", ""},
+		{"/reports/7", "export-report", "export-report"},
+		{"/reports/7", "", ""},
+	} {
+		rule, ok := matchRoute(rules, tt.path, tt.name)
+		if rule != tt.rule || ok != (tt.rule != "") {
+			t.Errorf("%s %q: got %q %v, want %q", tt.path, tt.name, rule, ok, tt.rule)
+		}
+	}
+	if rule, ok := matchRoute([]string{"/"}, "/anything", ""); !ok || rule != "/" {
+		t.Errorf("/ does not match everything")
+	}
+}
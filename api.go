@@ -2,14 +2,11 @@ package go_base_api
 
 import (
 	"context"
-	"encoding/json"
-	"flag"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -18,12 +15,9 @@ import (
 	logging "github.com/lordtor/go-logging"
 	trace "github.com/lordtor/go-trace-lib"
 	version "github.com/lordtor/go-version"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
 	swagger "github.com/swaggo/http-swagger"
-	muxprom "gitlab.com/msvechla/mux-prometheus/pkg/middleware"
 
-	// "go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel/attribute"
 )
 
@@ -38,23 +32,55 @@ type JSONResult struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 type ApiServerConfig struct {
-	ListenPort           int         `json:"listen_port" yaml:"listen_port"`
-	WriteTimeout         int         `json:"write_timeout" yaml:"write_timeout"`
-	ReadTimeout          int         `json:"read_timeout" yaml:"read_timeout"`
-	GracefulTimeout      int         `json:"graceful_timeout" yaml:"graceful_timeout"`
-	IdleTimeout          int         `json:"idle_timeout" yaml:"idle_timeout"`
-	Swagger              bool        `json:"swagger" yaml:"swagger"`
-	Prometheus           bool        `json:"prometheus" yaml:"prometheus"`
-	LocalSwagger         bool        `json:"local_swagger" yaml:"local_swagger"`
-	Schema               string      `json:"schema" yaml:"schema"`
-	App                  string      `json:"app" yaml:"app"`
-	Host                 string      `json:"host" yaml:"host"`
-	ApiHost              string      `json:"api_host" yaml:"api_host"`
-	AllowedOrigins       []string    `json:"allowed_origins" yaml:"allowed_origins"`
-	AllowedHeaders       []string    `json:"allowed_header" yaml:"allowed_header"`
-	AllowedMethods       []string    `json:"allowed_methods" yaml:"allowed_methods"`
-	AppConfig            interface{} `json:"-"`
-	IgnoreLoggingRequest []string    `json:"ignore_logging_request" yaml:"ignore_logging_request"`
+	ListenPort           int                   `json:"listen_port" yaml:"listen_port"`
+	WriteTimeout         int                   `json:"write_timeout" yaml:"write_timeout"`
+	ReadTimeout          int                   `json:"read_timeout" yaml:"read_timeout"`
+	GracefulTimeout      int                   `json:"graceful_timeout" yaml:"graceful_timeout"`
+	IdleTimeout          int                   `json:"idle_timeout" yaml:"idle_timeout"`
+	Swagger              bool                  `json:"swagger" yaml:"swagger"`
+	Prometheus           bool                  `json:"prometheus" yaml:"prometheus"`
+	LocalSwagger         bool                  `json:"local_swagger" yaml:"local_swagger"`
+	Schema               string                `json:"schema" yaml:"schema"`
+	App                  string                `json:"app" yaml:"app"`
+	Host                 string                `json:"host" yaml:"host"`
+	ApiHost              string                `json:"api_host" yaml:"api_host"`
+	AllowedOrigins       []string              `json:"allowed_origins" yaml:"allowed_origins"`
+	AllowedHeaders       []string              `json:"allowed_header" yaml:"allowed_header"`
+	AllowedMethods       []string              `json:"allowed_methods" yaml:"allowed_methods"`
+	AppConfig            interface{}           `json:"-"`
+	IgnoreLoggingRequest []string              `json:"ignore_logging_request" yaml:"ignore_logging_request"`
+	TLSCertFile          string                `json:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile           string                `json:"tls_key_file" yaml:"tls_key_file"`
+	TLSMinVersion        string                `json:"tls_min_version" yaml:"tls_min_version"`
+	TLSCipherSuites      []string              `json:"tls_cipher_suites" yaml:"tls_cipher_suites"`
+	TLSClientCAFile      string                `json:"tls_client_ca_file" yaml:"tls_client_ca_file"`
+	TLSClientAuth        string                `json:"tls_client_auth" yaml:"tls_client_auth"`
+	TLSReloadInterval    int                   `json:"tls_reload_interval" yaml:"tls_reload_interval"`
+	HealthTimeout        int                   `json:"health_timeout" yaml:"health_timeout"`
+	HealthChecks         []HealthCheckConfig   `json:"health" yaml:"health"`
+	ShutdownDelay        int                   `json:"shutdown_delay" yaml:"shutdown_delay"`
+	ProblemJSON          bool                  `json:"problem_json" yaml:"problem_json"`
+	MaxBodyBytes         int64                 `json:"max_body_bytes" yaml:"max_body_bytes"`
+	RedactPatterns       []string              `json:"redact_patterns" yaml:"redact_patterns"`
+	TrustedProxies       []string              `json:"trusted_proxies" yaml:"trusted_proxies"`
+	InternalAuth         InternalAuthConfig    `json:"internal_auth" yaml:"internal_auth"`
+	ManagementPort       int                   `json:"management_port" yaml:"management_port"`
+	ManagementAddress    string                `json:"management_address" yaml:"management_address"`
+	RequestIDHeader      string                `json:"request_id_header" yaml:"request_id_header"`
+	AccessLog            AccessLogConfig       `json:"access_log" yaml:"access_log"`
+	Tracing              TracingConfig         `json:"tracing" yaml:"tracing"`
+	SpanPayload          SpanPayloadConfig     `json:"span_payload" yaml:"span_payload"`
+	MetricsPath          string                `json:"metrics_path" yaml:"metrics_path"`
+	GoCollector          bool                  `json:"go_collector" yaml:"go_collector"`
+	ProcessCollector     bool                  `json:"process_collector" yaml:"process_collector"`
+	Registerer           prometheus.Registerer `json:"-" yaml:"-"`
+	Gatherer             prometheus.Gatherer   `json:"-" yaml:"-"`
+	MetricsNamespace     string                `json:"metrics_namespace" yaml:"metrics_namespace"`
+	MetricsBuckets       []float64             `json:"metrics_buckets" yaml:"metrics_buckets"`
+	MetricsSizeBuckets   []float64             `json:"metrics_size_buckets" yaml:"metrics_size_buckets"`
+	RateLimit            RateLimitConfig       `json:"rate_limit" yaml:"rate_limit"`
+	JWT                  JWTConfig             `json:"jwt" yaml:"jwt"`
+	APIKeys              APIKeyConfig          `json:"api_keys" yaml:"api_keys"`
 }
 
 func (con *ApiServerConfig) ApiServerConfigUpdate(conf ApiServerConfig, config interface{}) {
@@ -63,6 +89,9 @@ func (con *ApiServerConfig) ApiServerConfigUpdate(conf ApiServerConfig, config i
 		Log.Error("Cannot Merge data: ", err)
 	}
 	con.AppConfig = config
+	if con.TLSEnabled() && con.Schema == "http" {
+		con.Schema = "https"
+	}
 	if con.LocalSwagger {
 		con.ApiHost = fmt.Sprintf("%s:%d", con.Host, con.ListenPort)
 	} else {
@@ -74,9 +103,19 @@ func (con *ApiServerConfig) InitializeApiServerConfig(conf ApiServerConfig, conf
 	allowedOrigins := []string{"*"}
 	allowedHeaders := []string{"X-Requested-With", "Content-Type", "Authorization",
 		"SERVICE-AGENT", "Access-Control-Allow-Methods", "Date", "X-FORWARDED-FOR", "Accept",
-		"Content-Length", "Accept-Encoding", "Service-Agent"}
+		"Content-Length", "Accept-Encoding", "Service-Agent", "X-Request-ID"}
 	allowedMethods := []string{"GET", "POST", "PUT", "PATCH", "HEAD", "OPTIONS"}
-	ignoreLogging := []string{"/prometheus", "/health"}
+	// the built-in routes skipped by logging, tracing, rate limits and auth
+	metricsPath := conf.MetricsPath
+	if metricsPath == "" {
+		metricsPath = con.MetricsPath
+	}
+	if metricsPath == "" {
+		metricsPath = "/prometheus"
+	}
+	builtinRoutes := func(extra ...string) []string {
+		return append([]string{metricsPath, "/health"}, extra...)
+	}
 	err := mergo.Merge(con, ApiServerConfig{
 		ListenPort:           8080,
 		WriteTimeout:         30,
@@ -90,7 +129,23 @@ func (con *ApiServerConfig) InitializeApiServerConfig(conf ApiServerConfig, conf
 		AllowedOrigins:       allowedOrigins,
 		AllowedHeaders:       allowedHeaders,
 		AllowedMethods:       allowedMethods,
-		IgnoreLoggingRequest: ignoreLogging,
+		IgnoreLoggingRequest: builtinRoutes(),
+		TLSMinVersion:        "1.2",
+		TLSReloadInterval:    30,
+		HealthTimeout:        5,
+		MaxBodyBytes:         1 << 20,
+		RedactPatterns:       DefaultRedactPatterns,
+		InternalAuth:         InternalAuthConfig{APIKeyHeader: "X-API-Key"},
+		RequestIDHeader:      "X-Request-ID",
+		AccessLog:            AccessLogConfig{Format: AccessLogJSON},
+		Tracing:              TracingConfig{Ignore: builtinRoutes()},
+		SpanPayload:          SpanPayloadConfig{Mode: PayloadTruncate, MaxBytes: 1024},
+		MetricsPath:          metricsPath,
+		MetricsBuckets:       prometheus.DefBuckets,
+		MetricsSizeBuckets:   prometheus.ExponentialBuckets(100, 10, 7),
+		RateLimit:            RateLimitConfig{Key: RateLimitKeyIP, Header: "X-API-Key", Ignore: builtinRoutes(), Prefix: "ratelimit:"},
+		JWT:                  JWTConfig{JWKSRefresh: 300, Leeway: 60, Ignore: builtinRoutes("/swagger/")},
+		APIKeys:              APIKeyConfig{Header: "X-API-Key", ReloadInterval: 30, Ignore: builtinRoutes("/swagger/")},
 	})
 	if err != nil {
 		Log.Error("Cannot Merge data: ", err)
@@ -100,34 +155,119 @@ func (con *ApiServerConfig) InitializeApiServerConfig(conf ApiServerConfig, conf
 
 type API struct {
 	Router *mux.Router
-	Config ApiServerConfig
+	// Management serves the built-in routes. It is a separate router on
+	// ManagementPort when that is set, otherwise the same as Router.
+	Management *mux.Router
+	Config     ApiServerConfig
+	// RequestIDGenerator creates IDs for requests without a valid
+	// RequestIDHeader, NewRequestID when nil.
+	RequestIDGenerator func() string
+	// RateLimitStore keeps the rate limit counters, created from
+	// RateLimit.Store by Initialize when nil.
+	RateLimitStore RateLimitStore
+
+	mu          sync.Mutex
+	servers     []*http.Server
+	errc        chan error
+	stopped     chan struct{}
+	certs       *certReloader
+	stopCerts   context.CancelFunc
+	health      healthRegistry
+	encoders    []Encoder
+	draining    int32
+	panics      *prometheus.CounterVec
+	red         *redMetrics
+	rateLimited *prometheus.CounterVec
+	jwks        *jwtKeySet
+	apiKeys     *apiKeyStore
+	policies    map[*mux.Route][]string
+
+	trustedProxies []*net.IPNet
+	internalNets   []*net.IPNet
+
+	startHooks    []Hook
+	shutdownFuncs []shutdownFunc
 }
 
 func (a *API) Initialize(conf ApiServerConfig, config interface{}) {
 	a.Router = mux.NewRouter()
 	a.Config.InitializeApiServerConfig(conf, config)
+	a.Management = a.Router
+	if a.Config.ManagementPort > 0 {
+		a.Management = mux.NewRouter()
+	}
+	a.InitializeAccess()
 	a.InitializeSwagger()
 	a.InitializePrometheus()
-	a.Router.Use(a.Logging)
-	a.Router.Use(a.PanicRecovery)
-	//a.Router.Use(otelmux.Middleware(a.Config.App))
+	for _, r := range a.routers() {
+		if a.Config.Tracing.Enabled {
+			r.Use(a.Tracing)
+		}
+		r.Use(a.WithAPI)
+		r.Use(a.RequestID)
+		r.Use(a.Logging)
+		r.Use(a.PanicRecovery)
+	}
+	if a.Config.TLSEnabled() {
+		a.Router.Use(a.PeerIdentity)
+	}
+	// limits by IP run before the authenticators, so failed attempts count
+	byIP := a.Config.RateLimit.Key == "" || a.Config.RateLimit.Key == RateLimitKeyIP
+	if a.Config.RateLimit.Enabled {
+		if a.Config.Prometheus {
+			a.rateLimited = a.newRateLimitedCounter()
+		}
+		a.InitializeRateLimitStore()
+		if byIP {
+			a.Router.Use(a.RateLimit)
+		} else {
+			if a.Config.RateLimit.IP.Requests <= 0 {
+				Log.Warnf("rate_limit.key is %s without rate_limit.ip, unauthenticated clients are not limited", a.Config.RateLimit.Key)
+			}
+			a.Router.Use(a.IPRateLimit)
+		}
+	}
+	if a.Config.APIKeys.Enabled {
+		a.InitializeAPIKeys()
+		a.Router.Use(a.APIKeyAuth)
+	}
+	if a.Config.JWT.Enabled {
+		a.InitializeJWT()
+		a.Router.Use(a.JWTAuth)
+	}
+	if a.Config.RateLimit.Enabled && !byIP {
+		a.Router.Use(a.RateLimit)
+	}
 	a.initializeBaseRoutes()
+	a.InitializeHealthChecks()
 
 }
 
+// routers returns Router and, if it is separate, Management.
+func (a *API) routers() []*mux.Router {
+	if a.Management == nil || a.Management == a.Router {
+		return []*mux.Router{a.Router}
+	}
+	return []*mux.Router{a.Router, a.Management}
+}
+
 func (a *API) InitializeSwagger() {
 	if a.Config.Swagger {
 		if a.Config.LocalSwagger {
-			a.Router.PathPrefix("/swagger/").Handler(
+			schema, port := a.Config.Schema, a.Config.ListenPort
+			if a.Config.ManagementPort > 0 {
+				schema, port = "http", a.Config.ManagementPort
+			}
+			a.Management.PathPrefix("/swagger/").Handler(
 				swagger.Handler(
-					swagger.URL(fmt.Sprintf("%s://%s:%d/swagger/doc.json", a.Config.Schema, a.Config.Host, a.Config.ListenPort)),
+					swagger.URL(fmt.Sprintf("%s://%s:%d/swagger/doc.json", schema, a.Config.Host, port)),
 					swagger.DeepLinking(true),
 					swagger.DocExpansion("none"),
 					swagger.DomID("#swagger-ui"),
 				),
 			)
 		} else {
-			a.Router.PathPrefix("/swagger/").Handler(
+			a.Management.PathPrefix("/swagger/").Handler(
 				swagger.Handler(
 					swagger.URL(fmt.Sprintf("%s://%s/direct-container-url/%s/swagger/doc.json", a.Config.Schema, a.Config.Host, a.Config.App)),
 					swagger.DeepLinking(true),
@@ -140,9 +280,13 @@ func (a *API) InitializeSwagger() {
 }
 func (a *API) InitializePrometheus() {
 	if a.Config.Prometheus {
-		instrumentation := muxprom.NewDefaultInstrumentation()
-		a.Router.Use(instrumentation.Middleware)
-		a.Router.HandleFunc("/prometheus", otelhttp.NewHandler(promhttp.Handler(), "Prometheus").ServeHTTP).Methods(http.MethodGet)
+		a.Router.Use(a.muxInstrumentation().Middleware)
+		a.panics = newPanicsCounter(a.registerCollector)
+		a.red = a.newREDMetrics()
+		for _, r := range a.routers() {
+			r.Use(a.routeLabel)
+		}
+		a.describeRoute(a.Management.Handle(a.Config.MetricsPath, a.InternalAccess(a.metricsHandler())).Methods(http.MethodGet), internalAccessPolicy)
 	}
 }
 func (a *API) InitializeCORS() (header handlers.CORSOption, credentials handlers.CORSOption,
@@ -158,45 +302,6 @@ func (a *API) InitializeCORS() (header handlers.CORSOption, credentials handlers
 	return header, credentials, methods, origins
 }
 
-func (a *API) Run() {
-	var wait time.Duration
-	flag.DurationVar(&wait, "graceful-timeout", time.Second*time.Duration(a.Config.GracefulTimeout), "the duration for which the server gracefully wait for existing connections to finish - e.g. 15s or 1m")
-	flag.Parse()
-	srv := &http.Server{
-		Handler:      handlers.CORS(a.InitializeCORS())(a.Router),
-		Addr:         fmt.Sprint(":", a.Config.ListenPort),
-		WriteTimeout: time.Duration(a.Config.WriteTimeout) * time.Second,
-		ReadTimeout:  time.Duration(a.Config.ReadTimeout) * time.Second,
-		IdleTimeout:  time.Second * time.Duration(a.Config.IdleTimeout),
-	}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			Log.Error(err)
-		}
-	}()
-
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
-	// Block until we receive our signal.
-	<-c
-	// Create a deadline to wait for.
-	ctx, cancel := context.WithTimeout(context.Background(), wait)
-	defer cancel()
-	// Doesn't block if no connections, but will otherwise wait
-	// until the timeout deadline.
-	err := srv.Shutdown(ctx)
-	if err != nil {
-		Log.Error(err.Error())
-	}
-	// Optionally, you could run srv.Shutdown in a goroutine and block on
-	// <-ctx.Done() if your application should wait for other services
-	// to finalize based on context cancellation.
-	Log.Info("shutting down")
-	os.Exit(0)
-}
-
 func (a *API) Mount(path string, handler http.Handler) {
 	a.Router.PathPrefix(path).Handler(
 		http.StripPrefix(strings.TrimSuffix(path, "/"), handler),
@@ -204,10 +309,12 @@ func (a *API) Mount(path string, handler http.Handler) {
 }
 
 func (a *API) initializeBaseRoutes() {
-	a.Router.HandleFunc("/prometheus", promhttp.Handler().ServeHTTP).Methods(http.MethodGet)
-	a.Router.HandleFunc("/env", a.ShowConfig()).Methods(http.MethodGet)
-	a.Router.HandleFunc("/health", a.Health()).Methods(http.MethodGet)
-	a.Router.HandleFunc("/info", a.ShowInfo()).Methods(http.MethodGet)
+	a.describeRoute(a.Management.Handle("/env", a.InternalAccess(a.ShowConfig())).Methods(http.MethodGet), internalAccessPolicy)
+	a.Management.HandleFunc("/health", a.Health()).Methods(http.MethodGet)
+	a.Management.HandleFunc("/health/live", a.Liveness()).Methods(http.MethodGet)
+	a.Management.HandleFunc("/health/ready", a.Readiness()).Methods(http.MethodGet)
+	a.Management.HandleFunc("/health/startup", a.Startup()).Methods(http.MethodGet)
+	a.describeRoute(a.Management.Handle("/info", a.InternalAccess(a.ShowInfo())).Methods(http.MethodGet), internalAccessPolicy)
 }
 
 // ShowInfo godoc
@@ -215,20 +322,22 @@ func (a *API) initializeBaseRoutes() {
 // @Tags internal
 // @Description Internal method
 // @Accept  json
-// @Produce  json
+// @Produce  json,yaml,xml,application/msgpack
 // @Success 200 {object}  JSONResult "desc"
-// @Failure 400,404,405 {object} JSONResult
+// @Failure 400,401,403,404,405,406 {object} JSONResult
 // @Failure 500 {object} JSONResult
-// _Security ApiKeyAuth
+// @Security ApiKeyAuth
+// @Security BasicAuth
+// @Security BearerAuth
 // @Router /info [get]
 func (a *API) ShowInfo() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ver := getVersion(r.Context())
-		a.Resp(&JSONResult{
+		a.Render(w, r, &JSONResult{
 			Code:    http.StatusOK,
 			Message: "",
 			Data:    ver,
-		}, w, r.Context())
+		})
 	}
 }
 func getVersion(ctx context.Context) version.ApplicationVersion {
@@ -248,52 +357,30 @@ func getVersion(ctx context.Context) version.ApplicationVersion {
 // @Tags internal
 // @Description Internal method
 // @Accept  json
-// @Produce  json
+// @Produce  json,yaml,xml,application/msgpack
 // @Success 200 {object}  JSONResult "desc"
-// @Failure 400,404,405 {object} JSONResult
+// @Failure 400,401,403,404,405,406 {object} JSONResult
 // @Failure 500 {object} JSONResult
-// _Security ApiKeyAuth
+// @Security ApiKeyAuth
+// @Security BasicAuth
+// @Security BearerAuth
 // @Router /env [get]
 func (a *API) ShowConfig() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		a.Resp(&JSONResult{
+		a.Render(w, r, &JSONResult{
 			Code: http.StatusOK,
-			Data: getConfig(r.Context(), a.Config.AppConfig)}, w, r.Context())
+			Data: a.getConfig(r.Context(), a.Redact(a.Config.AppConfig))})
 	}
 }
-func getConfig(ctx context.Context, con interface{}) interface{} {
+func (a *API) getConfig(ctx context.Context, con interface{}) interface{} {
 
 	_, span := trace.NewSpan(ctx, "ShowInfo.getVersion", nil)
 	defer span.End()
-	ravC, err := json.Marshal(con)
-	if err != nil {
-		Log.Error(err)
-		span.SetStatus(1, "json.Marshal")
-		span.RecordError(err)
-	}
-	c := string(ravC)
-	span.SetAttributes(attribute.Key("Env").String(string(c)))
+	a.setPayload(span, "Env", con)
 	span.SetStatus(2, "")
 	return con
 }
 
-// Health godoc
-// @Summary Health check
-// @Tags internal
-// @Description Internal method
-// @Accept  json
-// @Produce  json
-// @Success 200 {object}  JSONResult "desc"
-// @Failure 400,404 {object} JSONResult
-// @Failure 500 {object} JSONResult
-// @Router /health [get]
-func (a *API) Health() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		respData := JSONResult{Code: http.StatusOK, Data: map[string]bool{"Alive": true}, Message: ""}
-		a.RespNoTrace(&respData, w)
-	}
-}
-
 // //Config ApiServerConfig
 // func Logg(Config ApiServerConfigr) http.Handler {
 // 	return func(next http.Handler) http.Handler {
@@ -308,62 +395,19 @@ func (a *API) Health() http.HandlerFunc {
 // 		})
 // 	}
 // }
-func (a *API) Logging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, req)
-		if !common_lib.SliceContain(a.Config.IgnoreLoggingRequest, req.RequestURI) {
-			Log.Debugf("%s %s %s", req.Method, req.RequestURI, time.Since(start))
-		} else {
-			Log.Tracef("%s %s %s", req.Method, req.RequestURI, time.Since(start))
-		}
-	})
-}
 
-func (a *API) PanicRecovery(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				Log.Error(err)
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			}
-		}()
-		next.ServeHTTP(w, req)
-	})
-}
+// RespNoTrace writes data as JSON whatever the Accept header.
+//
+// Deprecated: use RenderNoTrace, which negotiates the media type and answers 406.
 func (a *API) RespNoTrace(data *JSONResult, w http.ResponseWriter) {
-	w.Header().Set(DefaultCT[0], DefaultCT[1])
-	resp, err := json.Marshal(data)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(data.Code)
-	intE, err := w.Write(resp)
-	if err != nil {
-		http.Error(w, err.Error(), intE)
-		return
-	}
+	a.write(w, jsonEncoder{}, DefaultCT[1], data, nil)
 }
+
+// Resp writes data as JSON whatever the Accept header, in a span of ctx.
+//
+// Deprecated: use Render, which negotiates the media type and answers 406.
 func (a *API) Resp(data *JSONResult, w http.ResponseWriter, ctx context.Context) {
 	_, span := trace.NewSpan(ctx, "Resp", nil)
 	defer span.End()
-	w.Header().Set(DefaultCT[0], DefaultCT[1])
-	resp, err := json.Marshal(data)
-	span.SetStatus(2, data.Message)
-	span.SetAttributes(attribute.Key("Data").String(string(resp)))
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(1, data.Message)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(data.Code)
-	intE, err := w.Write(resp)
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(1, data.Message)
-		http.Error(w, err.Error(), intE)
-		return
-	}
+	a.write(w, jsonEncoder{}, DefaultCT[1], data, span)
 }
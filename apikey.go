@@ -0,0 +1,364 @@
+package go_base_api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// APIKeyConfig enables static API key authentication on API.Router. Keys are
+// read from Keys and the YAML File (a keys list), which is reloaded when it
+// changes (checked every ReloadInterval seconds) or on SIGHUP. Ignore lists
+// path prefixes or route names that need no key.
+type APIKeyConfig struct {
+	Enabled        bool     `json:"enabled" yaml:"enabled"`
+	Header         string   `json:"header" yaml:"header"`
+	Keys           []APIKey `json:"-" yaml:"keys"`
+	File           string   `json:"file" yaml:"file"`
+	ReloadInterval int      `json:"reload_interval" yaml:"reload_interval"`
+	Ignore         []string `json:"ignore" yaml:"ignore"`
+}
+
+// APIKey is a named client key, sent as "<name>.<secret>" so only the hash
+// of that name is checked. Hash is a bcrypt ($2a$/$2b$/$2y$), argon2
+// ($argon2id$/$argon2i$ in PHC format) or "sha256:<hex>" hash of the secret.
+// Names must be unique and must not contain a dot. Expires is RFC 3339 or
+// YYYY-MM-DD (valid through that day, UTC), empty for keys that never expire.
+type APIKey struct {
+	Name     string   `json:"name" yaml:"name"`
+	Hash     string   `json:"-" yaml:"hash"`
+	Scopes   []string `json:"scopes" yaml:"scopes"`
+	Expires  string   `json:"expires" yaml:"expires"`
+	Disabled bool     `json:"disabled" yaml:"disabled"`
+}
+
+type ctxKeyAPIKey struct{}
+
+// WithAPIKeyName returns a copy of ctx carrying the name of the API key used.
+func WithAPIKeyName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxKeyAPIKey{}, name)
+}
+
+// APIKeyNameFrom returns the name stored by APIKeyAuth, or "".
+func APIKeyNameFrom(ctx context.Context) string {
+	name, _ := ctx.Value(ctxKeyAPIKey{}).(string)
+	return name
+}
+
+type apiKeyEntry struct {
+	APIKey
+	expires time.Time
+}
+
+// apiKeyStore holds the configured keys by name and remembers the digests of
+// keys already verified, so the slow hashes are checked once per key and load.
+type apiKeyStore struct {
+	static []APIKey
+	file   string
+
+	mu       sync.RWMutex
+	keys     map[string]apiKeyEntry
+	verified map[[sha256.Size]byte]bool
+	modTime  time.Time
+	gen      int
+}
+
+func newAPIKeyStore(conf APIKeyConfig) *apiKeyStore {
+	s := &apiKeyStore{static: conf.Keys, file: conf.File}
+	if err := s.Reload(); err != nil {
+		Log.Error(err)
+	}
+	return s
+}
+
+// Reload reads Keys and File again. Invalid entries are skipped, on a file
+// error the previous keys are kept.
+func (s *apiKeyStore) Reload() error {
+	keys := s.static
+	var modTime time.Time
+	if s.file != "" {
+		modTime = s.fileModTime()
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return fmt.Errorf("load api keys: %w", err)
+		}
+		var f struct {
+			Keys []APIKey `yaml:"keys"`
+		}
+		if err := yaml.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("load api keys %s: %w", s.file, err)
+		}
+		keys = append(append([]APIKey{}, s.static...), f.Keys...)
+	}
+	entries := make(map[string]apiKeyEntry, len(keys))
+	for _, k := range keys {
+		e, err := newAPIKeyEntry(k)
+		if err == nil {
+			if _, dup := entries[k.Name]; dup {
+				err = errors.New("duplicate name")
+			}
+		}
+		if err != nil {
+			Log.Errorf("Skipping api key %q: %v", k.Name, err)
+			continue
+		}
+		entries[k.Name] = e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = entries
+	s.verified = map[[sha256.Size]byte]bool{}
+	s.modTime = modTime
+	s.gen++
+	return nil
+}
+
+func newAPIKeyEntry(k APIKey) (apiKeyEntry, error) {
+	e := apiKeyEntry{APIKey: k}
+	if k.Name == "" {
+		return e, errors.New("name is required")
+	}
+	if strings.Contains(k.Name, ".") {
+		return e, errors.New("name must not contain a dot")
+	}
+	if _, err := hashScheme(k.Hash); err != nil {
+		return e, err
+	}
+	if k.Expires != "" {
+		t, err := time.Parse(time.RFC3339, k.Expires)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", k.Expires); err != nil {
+				return e, fmt.Errorf("invalid expires %q", k.Expires)
+			}
+			// a date is valid through the end of that day (UTC)
+			t = t.AddDate(0, 0, 1)
+		}
+		e.expires = t
+	}
+	return e, nil
+}
+
+func (s *apiKeyStore) fileModTime() time.Time {
+	if fi, err := os.Stat(s.file); err == nil {
+		return fi.ModTime()
+	}
+	return time.Time{}
+}
+
+func (s *apiKeyStore) changed() bool {
+	modTime := s.fileModTime()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !modTime.Equal(s.modTime)
+}
+
+// watch polls File every interval (if > 0) and reloads on SIGHUP until ctx is done.
+func (s *apiKeyStore) watch(ctx context.Context, interval time.Duration) {
+	watchFiles(ctx, interval, "api keys", s.changed, s.Reload)
+}
+
+// lookup returns the key matching a presented "<name>.<secret>", whatever
+// its state. Only the hash of the named key is checked.
+func (s *apiKeyStore) lookup(presented string) (apiKeyEntry, bool) {
+	name, secret, ok := strings.Cut(presented, ".")
+	if !ok {
+		return apiKeyEntry{}, false
+	}
+	digest := sha256.Sum256([]byte(presented))
+	s.mu.RLock()
+	k, found := s.keys[name]
+	verified, gen := s.verified[digest], s.gen
+	s.mu.RUnlock()
+	if !found {
+		return apiKeyEntry{}, false
+	}
+	if verified {
+		return k, true
+	}
+	if !verifyKeyHash(k.Hash, secret) {
+		return apiKeyEntry{}, false
+	}
+	s.mu.Lock()
+	// skip if a reload replaced the keys meanwhile
+	if s.gen == gen {
+		s.verified[digest] = true
+	}
+	s.mu.Unlock()
+	return k, true
+}
+
+const (
+	hashBcrypt = "bcrypt"
+	hashArgon2 = "argon2"
+	hashSHA256 = "sha256"
+)
+
+// hashScheme validates hash and returns its scheme.
+func hashScheme(hash string) (string, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return "", err
+		}
+		return hashBcrypt, nil
+	case strings.HasPrefix(hash, "$argon2"):
+		if _, err := parseArgon2(hash); err != nil {
+			return "", err
+		}
+		return hashArgon2, nil
+	case strings.HasPrefix(hash, "sha256:"):
+		if len(hash) != len("sha256:")+2*sha256.Size {
+			return "", errors.New("invalid sha256 hash")
+		}
+		return hashSHA256, nil
+	}
+	return "", errors.New("unsupported hash format")
+}
+
+func verifyKeyHash(hash, key string) bool {
+	scheme, _ := hashScheme(hash)
+	switch scheme {
+	case hashBcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(key)) == nil
+	case hashArgon2:
+		p, err := parseArgon2(hash)
+		if err != nil {
+			return false
+		}
+		derive := argon2.IDKey
+		if p.variant == "argon2i" {
+			derive = argon2.Key
+		}
+		sum := derive([]byte(key), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		return subtle.ConstantTimeCompare(sum, p.key) == 1
+	case hashSHA256:
+		return matchSecret(hash, key)
+	}
+	return false
+}
+
+type argon2Params struct {
+	variant string
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2 parses "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>" with
+// unpadded base64 salt and key.
+func parseArgon2(hash string) (argon2Params, error) {
+	var p argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || (parts[1] != "argon2id" && parts[1] != "argon2i") {
+		return p, errors.New("invalid argon2 hash")
+	}
+	p.variant = parts[1]
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, errors.New("invalid argon2 salt")
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return p, errors.New("invalid argon2 key")
+	}
+	return p, nil
+}
+
+// InitializeAPIKeys loads the API keys and watches File from Start until Shutdown.
+func (a *API) InitializeAPIKeys() {
+	a.apiKeys = newAPIKeyStore(a.Config.APIKeys)
+	if a.Config.APIKeys.File == "" {
+		return
+	}
+	a.OnStart(func(context.Context) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		go a.apiKeys.watch(ctx, time.Second*time.Duration(a.Config.APIKeys.ReloadInterval))
+		a.RegisterShutdown("api key watcher", 0, func(context.Context) error {
+			cancel()
+			return nil
+		})
+		return nil
+	})
+}
+
+// ReloadAPIKeys reads the API keys again.
+func (a *API) ReloadAPIKeys() error {
+	if a.apiKeys == nil {
+		return errors.New("api keys are not enabled")
+	}
+	return a.apiKeys.Reload()
+}
+
+// APIKeyAuth authenticates requests carrying the APIKeys.Header on every
+// route not in APIKeys.Ignore and not guarded by InternalAccess. The key
+// name is stored with WithAPIKeyName and WithSubject, its scopes as Claims
+// (sub, scope) for Protect, and logged as api_key in the access log. Requests
+// without the header are passed to JWTAuth when it checks the route,
+// otherwise they get 401 like unknown, disabled and expired keys.
+func (a *API) APIKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := ""
+		if route := mux.CurrentRoute(req); route != nil {
+			name = route.GetName()
+		}
+		if _, ignored := matchRoute(a.Config.APIKeys.Ignore, req.URL.Path, name); ignored || a.internalRoute(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		presented := req.Header.Get(a.Config.APIKeys.Header)
+		if presented == "" {
+			if _, jwtIgnored := matchRoute(a.Config.JWT.Ignore, req.URL.Path, name); a.Config.JWT.Enabled && !jwtIgnored {
+				next.ServeHTTP(w, req)
+				return
+			}
+			a.Error(w, req, &APIError{Status: http.StatusUnauthorized, Detail: "api key is required", Err: ErrUnauthorized})
+			return
+		}
+		key, ok := a.apiKeys.lookup(presented)
+		detail := ""
+		switch {
+		case !ok:
+			detail = "invalid api key"
+		case key.Disabled:
+			detail = "api key is disabled"
+		case !key.expires.IsZero() && !time.Now().Before(key.expires):
+			detail = "api key is expired"
+		}
+		if detail != "" {
+			if ok {
+				SetAccessLogField(req.Context(), "api_key", key.Name)
+			}
+			a.Error(w, req, &APIError{Status: http.StatusUnauthorized, Detail: detail, Err: ErrUnauthorized})
+			return
+		}
+		ctx := WithAPIKeyName(req.Context(), key.Name)
+		ctx = WithSubject(ctx, key.Name)
+		ctx = WithClaims(ctx, Claims{"sub": key.Name, "scope": strings.Join(key.Scopes, " ")})
+		SetAccessLogField(ctx, "api_key", key.Name)
+		oteltrace.SpanFromContext(ctx).SetAttributes(semconv.EnduserIDKey.String(key.Name))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
@@ -0,0 +1,259 @@
+package go_base_api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func bcryptHash(t *testing.T, secret string) string {
+	t.Helper()
+	h, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(h)
+}
+
+func argon2Hash(variant, secret string) string {
+	salt := []byte("0123456789abcdef")
+	derive := argon2.IDKey
+	if variant == "argon2i" {
+		derive = argon2.Key
+	}
+	key := derive([]byte(secret), salt, 1, 1024, 1, 32)
+	return fmt.Sprintf("$%s$v=%d$m=1024,t=1,p=1$%s$%s", variant, argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func sha256Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestVerifyKeyHash(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"bcrypt", bcryptHash(t, "s3cret")},
+		{"argon2id", argon2Hash("argon2id", "s3cret")},
+		{"argon2i", argon2Hash("argon2i", "s3cret")},
+		{"sha256", sha256Hash("s3cret")},
+	}
+	for _, tt := range tests {
+		if _, err := hashScheme(tt.hash); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !verifyKeyHash(tt.hash, "s3cret") {
+			t.Errorf("%s: key not verified", tt.name)
+		}
+		for _, wrong := range []string{"", "s3cre", "s3cret ", "S3CRET"} {
+			if verifyKeyHash(tt.hash, wrong) {
+				t.Errorf("%s: %q verified", tt.name, wrong)
+			}
+		}
+	}
+	for _, hash := range []string{
+		"",
+		"s3cret",
+		"$2a$04$short",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2d$v=19$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"sha256:abc",
+		"md5:5ebe2294ecd0e0f08eab7690d2a6ee69",
+	} {
+		if _, err := hashScheme(hash); err == nil {
+			t.Errorf("%q: accepted", hash)
+		}
+		if verifyKeyHash(hash, "s3cret") {
+			t.Errorf("%q: verified", hash)
+		}
+	}
+}
+
+func TestAPIKeyStoreLookup(t *testing.T) {
+	s := newAPIKeyStore(APIKeyConfig{Keys: []APIKey{
+		{Name: "billing", Hash: argon2Hash("argon2id", "b1ll"), Scopes: []string{"orders:read"}},
+		{Name: "reports", Hash: sha256Hash("r3p")},
+		{Name: "reports", Hash: sha256Hash("other")},
+		{Name: "bad.name", Hash: sha256Hash("x")},
+		{Name: "broken", Hash: "plain"},
+	}})
+	if len(s.keys) != 2 {
+		t.Fatalf("loaded %d keys, want 2", len(s.keys))
+	}
+	for _, tt := range []struct {
+		presented, name string
+	}{
+		{"billing.b1ll", "billing"},
+		{"billing.b1ll", "billing"}, // cached
+		{"reports.r3p", "reports"},
+		{"reports.other", ""},
+		{"billing.r3p", ""},
+		{"reports.b1ll", ""},
+		{"b1ll", ""},
+		{"bad.name.x", ""},
+		{"unknown.b1ll", ""},
+		{".b1ll", ""},
+	} {
+		k, ok := s.lookup(tt.presented)
+		if ok != (tt.name != "") || k.Name != tt.name {
+			t.Errorf("%q: got %q %v, want %q", tt.presented, k.Name, ok, tt.name)
+		}
+	}
+	if len(s.verified) != 2 {
+		t.Errorf("cached %d verifications, want 2", len(s.verified))
+	}
+
+	// a reload forgets the verified keys
+	s.static = []APIKey{{Name: "billing", Hash: sha256Hash("n3w")}}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.lookup("billing.b1ll"); ok {
+		t.Error("old key accepted after reload")
+	}
+	if _, ok := s.lookup("billing.n3w"); !ok {
+		t.Error("new key rejected after reload")
+	}
+}
+
+func TestAPIKeyStoreFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.yaml")
+	write := func(hash string) {
+		data := fmt.Sprintf("keys:\n  - name: ci\n    hash: %q\n", hash)
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(bcryptHash(t, "one"))
+	s := newAPIKeyStore(APIKeyConfig{File: file, Keys: []APIKey{{Name: "static", Hash: sha256Hash("s")}}})
+	if _, ok := s.lookup("ci.one"); !ok {
+		t.Fatal("file key rejected")
+	}
+	if s.changed() {
+		t.Error("unchanged file reported as changed")
+	}
+	write(sha256Hash("two"))
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !s.changed() {
+		t.Error("changed file not reported")
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.lookup("ci.one"); ok {
+		t.Error("replaced key accepted")
+	}
+	if _, ok := s.lookup("ci.two"); !ok {
+		t.Error("reloaded key rejected")
+	}
+	os.Remove(file)
+	if err := s.Reload(); err == nil {
+		t.Error("missing file not reported")
+	}
+	if _, ok := s.lookup("ci.two"); !ok {
+		t.Error("keys dropped on a failed reload")
+	}
+	if _, ok := s.lookup("static.s"); !ok {
+		t.Error("static key rejected")
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	a := &API{}
+	a.Config.App = "test"
+	a.Config.APIKeys = APIKeyConfig{Enabled: true, Header: "X-API-Key", Ignore: []string{"/health"}, Keys: []APIKey{
+		{Name: "billing", Hash: sha256Hash("b1ll"), Scopes: []string{"orders:read", "orders:write"}},
+		{Name: "old", Hash: sha256Hash("0ld"), Expires: "2020-01-01"},
+		{Name: "off", Hash: sha256Hash("0ff"), Disabled: true},
+		{Name: "today", Hash: sha256Hash("t0d"), Expires: time.Now().UTC().Format("2006-01-02")},
+	}}
+	a.Config.InternalAuth = InternalAuthConfig{APIKeyHeader: "X-API-Key", APIKeys: []string{"internal"}}
+	a.InitializeAPIKeys()
+
+	var claims Claims
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { claims = ClaimsFrom(r.Context()) })
+	r := mux.NewRouter()
+	r.Use(a.APIKeyAuth)
+	r.Handle("/orders", ok)
+	r.Handle("/health", ok)
+	a.describeRoute(r.Handle("/env", a.InternalAccess(ok)), internalAccessPolicy)
+
+	for _, tt := range []struct {
+		path, key string
+		status    int
+	}{
+		{"/orders", "billing.b1ll", 200},
+		{"/orders", "", 401},
+		{"/orders", "billing.wrong", 401},
+		{"/orders", "b1ll", 401},
+		{"/orders", "old.0ld", 401},
+		{"/orders", "off.0ff", 401},
+		{"/orders", "today.t0d", 200},
+		{"/health", "", 200},
+		{"/env", "internal", 200},
+		{"/env", "billing.b1ll", 401},
+	} {
+		claims = nil
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %q: status %d, want %d: %s", tt.path, tt.key, rec.Code, tt.status, rec.Body)
+		}
+		if tt.key == "billing.b1ll" && tt.path == "/orders" {
+			if claims.Subject() != "billing" || len(claims.Scopes()) != 2 {
+				t.Errorf("claims %v", claims)
+			}
+		}
+	}
+
+	// without a key the token decides, unless JWT ignores the route
+	a.Config.JWT = JWTConfig{Enabled: true, Secret: "secret", Ignore: []string{"/health", "/reports"}}
+	r.Handle("/reports", ok)
+	r.Use(a.JWTAuth)
+	token := "Bearer " + signToken(t, map[string]interface{}{"alg": "HS256"}, validClaims(), []byte("secret"))
+	for _, tt := range []struct {
+		path, key, auth string
+		status          int
+	}{
+		{"/orders", "", token, 200},
+		{"/orders", "", "", 401},
+		{"/reports", "", token, 401},
+		{"/reports", "billing.b1ll", "", 200},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("with jwt %s %q: status %d, want %d: %s", tt.path, tt.key, rec.Code, tt.status, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package go_base_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	trace "github.com/lordtor/go-trace-lib"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v2"
+)
+
+// Encoder writes response values in one media type. The first of MediaTypes
+// is used as Content-Type, the others are accepted aliases.
+type Encoder interface {
+	MediaTypes() []string
+	Encode(w io.Writer, v interface{}) error
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) MediaTypes() []string { return []string{"application/json"} }
+func (jsonEncoder) Encode(w io.Writer, v interface{}) error {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(resp)
+	return err
+}
+
+type yamlEncoder struct{}
+
+func (yamlEncoder) MediaTypes() []string {
+	return []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"}
+}
+func (yamlEncoder) Encode(w io.Writer, v interface{}) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	resp, err := yaml.Marshal(g)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(resp)
+	return err
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+func (msgpackEncoder) Encode(w io.Writer, v interface{}) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	enc := msgpack.NewEncoder(w)
+	enc.UseCompactInts(true)
+	return enc.Encode(g)
+}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) MediaTypes() []string { return []string{"application/xml", "text/xml"} }
+func (xmlEncoder) Encode(w io.Writer, v interface{}) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err := encodeXMLElement(enc, "response", g); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+var xmlNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func encodeXMLElement(enc *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlNameRe.MatchString(name) {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXMLElement(enc, k, val[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range val {
+			if err := encodeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(val))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// toGeneric converts v through its JSON form, so every encoder uses the json
+// field names and `json:"-"` exclusions.
+func toGeneric(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var g interface{}
+	if err := dec.Decode(&g); err != nil {
+		return nil, err
+	}
+	return convertNumbers(g), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	}
+	return v
+}
+
+// DefaultEncoders returns the JSON, YAML, XML and MessagePack encoders. JSON is the default.
+func DefaultEncoders() []Encoder {
+	return []Encoder{jsonEncoder{}, yamlEncoder{}, xmlEncoder{}, msgpackEncoder{}}
+}
+
+// RegisterEncoder adds e to the content negotiation, replacing an encoder with the same media type.
+func (a *API) RegisterEncoder(e Encoder) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.encoders == nil {
+		a.encoders = DefaultEncoders()
+	}
+	for i, enc := range a.encoders {
+		if enc.MediaTypes()[0] == e.MediaTypes()[0] {
+			a.encoders[i] = e
+			return
+		}
+	}
+	a.encoders = append(a.encoders, e)
+}
+
+func (a *API) getEncoders() []Encoder {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.encoders == nil {
+		a.encoders = DefaultEncoders()
+	}
+	return a.encoders
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mt, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(qs, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mt, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	return ranges
+}
+
+// NegotiateEncoder picks the encoder and media type for the Accept header of r,
+// JSON if the header is empty. It returns false if no registered encoder is acceptable.
+func (a *API) NegotiateEncoder(r *http.Request) (Encoder, string, bool) {
+	encoders := a.getEncoders()
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return encoders[0], encoders[0].MediaTypes()[0], true
+	}
+	for _, ar := range parseAccept(accept) {
+		for _, enc := range encoders {
+			for _, mt := range enc.MediaTypes() {
+				if ar.mediaType == mt {
+					return enc, mt, true
+				}
+				if ar.mediaType == "*/*" ||
+					(strings.HasSuffix(ar.mediaType, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(ar.mediaType, "*"))) {
+					return enc, enc.MediaTypes()[0], true
+				}
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func (a *API) notAcceptable(w http.ResponseWriter) {
+	supported := []string{}
+	for _, enc := range a.getEncoders() {
+		supported = append(supported, enc.MediaTypes()[0])
+	}
+	a.write(w, jsonEncoder{}, DefaultCT[1], &JSONResult{
+		Code:    http.StatusNotAcceptable,
+		Message: "supported media types: " + strings.Join(supported, ", "),
+	}, nil)
+}
+
+// Render writes data in the media type negotiated from the Accept header,
+// answering 406 if none is supported.
+func (a *API) Render(w http.ResponseWriter, r *http.Request, data *JSONResult) {
+	enc, ct, ok := a.NegotiateEncoder(r)
+	if !ok {
+		a.notAcceptable(w)
+		return
+	}
+	_, span := trace.NewSpan(r.Context(), "Resp", nil)
+	defer span.End()
+	if id := RequestIDFrom(r.Context()); id != "" {
+		span.SetAttributes(attribute.String("request_id", id))
+	}
+	a.write(w, enc, ct, data, span)
+}
+
+// RenderNoTrace is Render without a span, for high-volume routes like /health.
+func (a *API) RenderNoTrace(w http.ResponseWriter, r *http.Request, data *JSONResult) {
+	enc, ct, ok := a.NegotiateEncoder(r)
+	if !ok {
+		a.notAcceptable(w)
+		return
+	}
+	a.write(w, enc, ct, data, nil)
+}
+
+func (a *API) write(w http.ResponseWriter, enc Encoder, contentType string, data *JSONResult, span oteltrace.Span) {
+	var buf bytes.Buffer
+	err := enc.Encode(&buf, data)
+	if span != nil {
+		span.SetStatus(2, data.Message)
+		a.setPayload(span, "Data", data)
+	}
+	if err != nil {
+		if span != nil {
+			span.RecordError(err)
+			span.SetStatus(1, data.Message)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(DefaultCT[0], contentType)
+	w.WriteHeader(data.Code)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		if span != nil {
+			span.RecordError(err)
+			span.SetStatus(1, data.Message)
+		}
+		Log.Error(err)
+	}
+}
@@ -0,0 +1,164 @@
+package go_base_api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Sentinel errors mapped to status codes by API.Error, wrap them with fmt.Errorf("...: %w", err).
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrValidation      = errors.New("validation failed")
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+var sentinelStatus = []struct {
+	err    error
+	status int
+}{
+	{ErrBadRequest, http.StatusBadRequest},
+	{ErrUnauthorized, http.StatusUnauthorized},
+	{ErrForbidden, http.StatusForbidden},
+	{ErrNotFound, http.StatusNotFound},
+	{ErrConflict, http.StatusConflict},
+	{ErrValidation, http.StatusUnprocessableEntity},
+	{ErrTooManyRequests, http.StatusTooManyRequests},
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is an RFC 7807 problem detail.
+type APIError struct {
+	Type      string       `json:"type,omitempty"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	TraceID   string       `json:"trace_id,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Err       error        `json:"-"`
+}
+
+func NewAPIError(status int, detail string) *APIError {
+	return &APIError{Status: status, Detail: detail}
+}
+
+// NewValidationError returns a 422 error listing the invalid fields.
+func NewValidationError(fields ...FieldError) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Errors: fields, Err: ErrValidation}
+}
+
+func (e *APIError) Error() string {
+	if e.Detail != "" {
+		return e.Detail
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status))
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// toAPIError converts err into an APIError. Unknown errors become a 500
+// without detail, so internal messages are not sent to clients.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		e := *apiErr
+		if e.Status == 0 {
+			e.Status = http.StatusInternalServerError
+		}
+		return &e
+	}
+	for _, s := range sentinelStatus {
+		if errors.Is(err, s.err) {
+			return &APIError{Status: s.status, Detail: err.Error(), Err: err}
+		}
+	}
+	return &APIError{Status: http.StatusInternalServerError, Err: err}
+}
+
+// Error writes err as application/problem+json when ProblemJSON is enabled,
+// otherwise as the JSONResult envelope. Wrapped sentinel errors are mapped to
+// their status codes, other errors are logged and answered with 500.
+func (a *API) Error(w http.ResponseWriter, r *http.Request, err error) {
+	e := newProblem(r, err)
+	if e.Status >= http.StatusInternalServerError {
+		LoggerFrom(r.Context()).Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		span := oteltrace.SpanFromContext(r.Context())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, e.Title)
+	}
+	a.writeError(w, r, e)
+}
+
+// newProblem maps err to an APIError with the defaults, trace and request IDs filled.
+func newProblem(r *http.Request, err error) *APIError {
+	e := toAPIError(err)
+	if e.Type == "" {
+		e.Type = "about:blank"
+	}
+	if e.Title == "" {
+		e.Title = http.StatusText(e.Status)
+	}
+	if e.Instance == "" {
+		e.Instance = r.URL.Path
+	}
+	if sc := oteltrace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		e.TraceID = sc.TraceID().String()
+	}
+	if e.RequestID == "" {
+		e.RequestID = RequestIDFrom(r.Context())
+	}
+	return e
+}
+
+func (a *API) writeError(w http.ResponseWriter, r *http.Request, e *APIError) {
+	if !a.Config.ProblemJSON {
+		result := JSONResult{Code: e.Status, Message: e.message()}
+		if len(e.Errors) > 0 {
+			result.Data = e.Errors
+		}
+		enc, ct, ok := a.NegotiateEncoder(r)
+		if !ok {
+			enc, ct = jsonEncoder{}, DefaultCT[1]
+		}
+		a.write(w, enc, ct, &result, nil)
+		return
+	}
+	resp, mErr := json.Marshal(e)
+	if mErr != nil {
+		http.Error(w, mErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(DefaultCT[0], ProblemContentType)
+	w.WriteHeader(e.Status)
+	if _, wErr := w.Write(resp); wErr != nil {
+		Log.Error(wErr)
+	}
+}
+
+func (e *APIError) message() string {
+	if e.Detail != "" {
+		return e.Detail
+	}
+	return e.Title
+}
@@ -90,7 +90,7 @@ func (conf *C) ReloadConfig() {
 	logging.ChangeLogLevel(conf.LogLevel)
 	logging.Log.Info(conf.LogLevel)
 	if strings.ToLower(conf.LogLevel) == "debug" {
-		conf.PrintConfigToLog()
+		api.PrintConfigToLog(conf)
 	}
 }
 func (conf *C) ParseCloudFile() {
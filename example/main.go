@@ -8,9 +8,15 @@
 // @license.name Apache 2.0
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 
-// _securityDefinitions.apikey ApiKeyAuth
-// _in header
-// _name Authorization
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+
+// @securityDefinitions.basic BasicAuth
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 
 package main
 
@@ -63,16 +69,18 @@ func main() {
 		docs.SwaggerInfo.Schemes = []string{Conf.API.Schema}
 		docs.SwaggerInfo.Host = Conf.API.ApiHost
 	}
+	// Bootstrap api.
+	a := api.API{}
+	a.Initialize(Conf.API, Conf)
 	// Bootstrap tracer.
 	prv, err := trace.NewProvider(Conf.Trace)
 	if err != nil {
 		Log.Fatalln(err)
 	}
-	defer prv.Close(ctx)
-	// Bootstrap api.
-	a := api.API{}
-	a.Initialize(Conf.API, Conf)
+	a.OnShutdown(prv.Close)
 	// Mount anothe routes
 	// a.Mount(fmt.Sprintf("/%s/anothe api/", Conf.AppName), anothe.Routes(Conf.Anothe))
-	a.Run()
+	if err := a.RunContext(ctx); err != nil {
+		Log.Error(err)
+	}
 }
@@ -0,0 +1,238 @@
+package go_base_api
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+type ctxKeyAPI struct{}
+
+// StatusCoder lets a typed handler response choose its HTTP status code.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Validator is called after struct-tag validation for checks that need code.
+type Validator interface {
+	Validate() error
+}
+
+// WithAPI stores the API in the request context so typed handlers render
+// results and errors with its configuration.
+func (a *API) WithAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), ctxKeyAPI{}, a)))
+	})
+}
+
+func apiFromContext(ctx context.Context) *API {
+	if a, ok := ctx.Value(ctxKeyAPI{}).(*API); ok {
+		return a
+	}
+	return &API{}
+}
+
+// Handle adapts fn to an http.HandlerFunc. The request body (JSON), path vars
+// (`path` tag), query (`query` tag) and headers (`header` tag) are decoded
+// into Req, validated with `validate` tags and Validator, then the result is
+// written as JSONResult in the negotiated media type and errors through API.Error.
+func Handle[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a := apiFromContext(r.Context())
+		var req Req
+		if err := a.decodeRequest(r, &req); err != nil {
+			a.Error(w, r, err)
+			return
+		}
+		a.setPayload(oteltrace.SpanFromContext(r.Context()), "Request", req)
+		if err := validateRequest(&req); err != nil {
+			a.Error(w, r, err)
+			return
+		}
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			a.Error(w, r, err)
+			return
+		}
+		code := http.StatusOK
+		if sc, ok := interface{}(resp).(StatusCoder); ok {
+			code = sc.StatusCode()
+		}
+		a.Render(w, r, &JSONResult{Code: code, Data: resp})
+	}
+}
+
+func badRequest(field, msg string) *APIError {
+	e := &APIError{Status: http.StatusBadRequest, Detail: msg, Err: ErrBadRequest}
+	if field != "" {
+		e.Errors = []FieldError{{Field: field, Message: msg}}
+	}
+	return e
+}
+
+func (a *API) decodeRequest(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+	allocate(v)
+	if r.Body != nil && r.Body != http.NoBody {
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			if mt, _, _ := mime.ParseMediaType(ct); mt != "application/json" && !strings.HasSuffix(mt, "+json") {
+				return &APIError{Status: http.StatusUnsupportedMediaType, Detail: fmt.Sprintf("unsupported content type %q", mt)}
+			}
+		}
+		body := io.Reader(r.Body)
+		if a.Config.MaxBodyBytes > 0 {
+			body = io.LimitReader(r.Body, a.Config.MaxBodyBytes+1)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return badRequest("", err.Error())
+		}
+		if a.Config.MaxBodyBytes > 0 && int64(len(data)) > a.Config.MaxBodyBytes {
+			return &APIError{Status: http.StatusRequestEntityTooLarge, Detail: fmt.Sprintf("body exceeds %d bytes", a.Config.MaxBodyBytes)}
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, dst); err != nil {
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(err, &typeErr) {
+					return badRequest(typeErr.Field, fmt.Sprintf("must be %s", typeErr.Type))
+				}
+				return badRequest("", "invalid JSON body: "+err.Error())
+			}
+			// a null body resets the pointer
+			allocate(v)
+		}
+	}
+
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	return decodeParams(v, mux.Vars(r), r.URL.Query(), r.Header)
+}
+
+// allocate points a nil Req *T (or **T) at a zero T, so params are decoded
+// and validated when the body is empty.
+func allocate(v reflect.Value) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+}
+
+func decodeParams(v reflect.Value, vars map[string]string, query map[string][]string, header http.Header) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && fv.Kind() == reflect.Struct {
+			if err := decodeParams(fv, vars, query, header); err != nil {
+				return err
+			}
+			continue
+		}
+		var name string
+		var values []string
+		if name = f.Tag.Get("path"); name != "" {
+			if val, ok := vars[name]; ok {
+				values = []string{val}
+			}
+		} else if name = f.Tag.Get("query"); name != "" {
+			values = query[name]
+		} else if name = f.Tag.Get("header"); name != "" {
+			values = header.Values(name)
+		} else {
+			continue
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(fv, values); err != nil {
+			return badRequest(name, err.Error())
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setField(v.Elem(), values)
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(values[0]))
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, val := range values {
+			if err := setField(s.Index(i), []string{val}); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	val := values[0]
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("must be a duration")
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a positive integer")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
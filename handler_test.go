@@ -0,0 +1,88 @@
+package go_base_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+type handlerReq struct {
+	ID    int      `json:"id" path:"id" validate:"required"`
+	Limit int      `json:"limit" query:"limit" validate:"max=100"`
+	Tags  []string `json:"tags" query:"tag"`
+	Trace string   `json:"trace" header:"X-Trace"`
+	Name  string   `json:"name"`
+}
+
+func (r *handlerReq) Validate() error {
+	if r.Name == "forbidden" {
+		return errors.New("name is forbidden")
+	}
+	return nil
+}
+
+func TestHandle(t *testing.T) {
+	a := &API{}
+	r := mux.NewRouter()
+	r.Use(a.WithAPI)
+	r.Handle("/value/{id}", Handle(func(_ context.Context, req handlerReq) (handlerReq, error) {
+		return req, nil
+	}))
+	r.Handle("/pointer/{id}", Handle(func(_ context.Context, req *handlerReq) (*handlerReq, error) {
+		return req, nil
+	}))
+
+	for _, prefix := range []string{"/value", "/pointer"} {
+		for _, tt := range []struct {
+			name   string
+			target string
+			body   string
+			header string
+			status int
+			want   handlerReq
+		}{
+			{"params", "/42?limit=5&tag=a&tag=b", "", "t1", 200, handlerReq{ID: 42, Limit: 5, Tags: []string{"a", "b"}, Trace: "t1"}},
+			{"body and params", "/7", `{"name":"x","id":1}`, "", 200, handlerReq{ID: 7, Name: "x"}},
+			{"null body", "/7", "null", "", 200, handlerReq{ID: 7}},
+			{"bad param", "/x", "", "", 400, handlerReq{}},
+			{"bad body", "/7", `{"name":1}`, "", 400, handlerReq{}},
+			{"validate tag", "/7?limit=500", "", "", 422, handlerReq{}},
+			{"required", "/0", "", "", 422, handlerReq{}},
+			{"validator", "/7", `{"name":"forbidden"}`, "", 422, handlerReq{}},
+		} {
+			method := http.MethodGet
+			if tt.body != "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, prefix+tt.target, strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set("X-Trace", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("%s %s: status %d, want %d: %s", prefix, tt.name, rec.Code, tt.status, rec.Body)
+				continue
+			}
+			if tt.status != 200 {
+				continue
+			}
+			var got struct {
+				Data handlerReq `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%s %s: %v", prefix, tt.name, err)
+			}
+			if !reflect.DeepEqual(got.Data, tt.want) {
+				t.Errorf("%s %s: got %+v, want %+v", prefix, tt.name, got.Data, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package go_base_api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Probe string
+
+const (
+	ProbeLiveness  Probe = "live"
+	ProbeReadiness Probe = "ready"
+	ProbeStartup   Probe = "startup"
+
+	HealthStatusUp   = "UP"
+	HealthStatusDown = "DOWN"
+)
+
+// HealthChecker is a single dependency check reported by the health endpoints.
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type healthCheckFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (h healthCheckFunc) Name() string                    { return h.name }
+func (h healthCheckFunc) Check(ctx context.Context) error { return h.fn(ctx) }
+
+// NewHealthCheck wraps fn into a HealthChecker.
+func NewHealthCheck(name string, fn func(ctx context.Context) error) HealthChecker {
+	return healthCheckFunc{name: name, fn: fn}
+}
+
+type CheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Alive  bool                   `json:"Alive,omitempty"`
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+	TLS    *CertificateStatus     `json:"TLS,omitempty"`
+}
+
+type healthRegistry struct {
+	mu     sync.RWMutex
+	checks map[Probe][]healthEntry
+	names  map[string]bool
+	next   int
+}
+
+// healthEntry is one registration, id tells registrations apart since
+// checkers need not be comparable.
+type healthEntry struct {
+	id int
+	HealthChecker
+}
+
+// renamedChecker reports c under another name.
+type renamedChecker struct {
+	HealthChecker
+	name string
+}
+
+func (r renamedChecker) Name() string { return r.name }
+
+// add registers c for probes. A name already taken by another checker gets
+// a "-2", "-3", ... suffix, so every checker runs and keeps its own result.
+func (h *healthRegistry) add(c HealthChecker, probes ...Probe) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.checks == nil {
+		h.checks = map[Probe][]healthEntry{}
+		h.names = map[string]bool{}
+	}
+	if name := c.Name(); h.names[name] {
+		unique := name
+		for i := 2; h.names[unique]; i++ {
+			unique = fmt.Sprintf("%s-%d", name, i)
+		}
+		Log.Warnf("Health check %q is already registered, reporting this one as %q", name, unique)
+		c = renamedChecker{HealthChecker: c, name: unique}
+	}
+	h.names[c.Name()] = true
+	h.next++
+	for _, p := range probes {
+		h.checks[p] = append(h.checks[p], healthEntry{id: h.next, HealthChecker: c})
+	}
+}
+
+func (h *healthRegistry) get(probes ...Probe) []HealthChecker {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var out []HealthChecker
+	seen := map[int]bool{}
+	for _, p := range probes {
+		for _, e := range h.checks[p] {
+			if !seen[e.id] {
+				seen[e.id] = true
+				out = append(out, e.HealthChecker)
+			}
+		}
+	}
+	return out
+}
+
+// AddHealthChecker registers c for the given probes, readiness if none is
+// given. A checker reusing the name of another one is reported as
+// "<name>-2", "<name>-3", ...
+func (a *API) AddHealthChecker(c HealthChecker, probes ...Probe) {
+	if len(probes) == 0 {
+		probes = []Probe{ProbeReadiness}
+	}
+	a.health.add(c, probes...)
+}
+
+// CheckHealth runs the checks registered for probes concurrently and aggregates the result.
+// While the server is draining the readiness probe always reports DOWN.
+func (a *API) CheckHealth(ctx context.Context, probes ...Probe) HealthReport {
+	checks := a.health.get(probes...)
+	report := HealthReport{Status: HealthStatusUp, Checks: make(map[string]CheckResult, len(checks)+1)}
+	if a.Draining() && containsProbe(probes, ProbeReadiness) {
+		report.Status = HealthStatusDown
+		report.Checks["shutdown"] = CheckResult{Status: HealthStatusDown, Error: "server is shutting down"}
+	}
+	timeout := time.Second * time.Duration(a.Config.HealthTimeout)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c HealthChecker) {
+			defer wg.Done()
+			res := runHealthCheck(ctx, c, timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.Name()] = res
+			if res.Status != HealthStatusUp {
+				report.Status = HealthStatusDown
+			}
+		}(c)
+	}
+	wg.Wait()
+	return report
+}
+
+func containsProbe(probes []Probe, p Probe) bool {
+	for _, probe := range probes {
+		if probe == p {
+			return true
+		}
+	}
+	return false
+}
+
+func runHealthCheck(ctx context.Context, c HealthChecker, timeout time.Duration) (res CheckResult) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			Log.Errorf("health check %s panic: %v", c.Name(), err)
+			res = CheckResult{Status: HealthStatusDown, Error: "panic", Latency: time.Since(start).String()}
+		}
+	}()
+	err := c.Check(ctx)
+	res = CheckResult{Status: HealthStatusUp, Latency: time.Since(start).String()}
+	if err != nil {
+		res.Status = HealthStatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func (a *API) respHealth(w http.ResponseWriter, r *http.Request, report HealthReport) {
+	code := http.StatusOK
+	if report.Status != HealthStatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	a.RenderNoTrace(w, r, &JSONResult{Code: code, Data: report})
+}
+
+// Health godoc
+// @Summary Health check
+// @Tags internal
+// @Description Internal method, aggregates liveness and readiness checks
+// @Accept  json
+// @Produce  json,yaml,xml,application/msgpack
+// @Success 200 {object}  JSONResult "desc"
+// @Failure 400,404,406 {object} JSONResult
+// @Failure 500,503 {object} JSONResult
+// @Router /health [get]
+func (a *API) Health() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := a.CheckHealth(r.Context(), ProbeLiveness, ProbeReadiness)
+		report.Alive = true
+		if status, ok := a.CertificateStatus(); ok {
+			report.TLS = &status
+		}
+		a.respHealth(w, r, report)
+	}
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Tags internal
+// @Description Internal method
+// @Produce  json,yaml,xml,application/msgpack
+// @Success 200 {object}  JSONResult "desc"
+// @Failure 503 {object} JSONResult
+// @Router /health/live [get]
+func (a *API) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.respHealth(w, r, a.CheckHealth(r.Context(), ProbeLiveness))
+	}
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Tags internal
+// @Description Internal method
+// @Produce  json,yaml,xml,application/msgpack
+// @Success 200 {object}  JSONResult "desc"
+// @Failure 503 {object} JSONResult
+// @Router /health/ready [get]
+func (a *API) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.respHealth(w, r, a.CheckHealth(r.Context(), ProbeReadiness))
+	}
+}
+
+// Startup godoc
+// @Summary Startup probe
+// @Tags internal
+// @Description Internal method
+// @Produce  json,yaml,xml,application/msgpack
+// @Success 200 {object}  JSONResult "desc"
+// @Failure 503 {object} JSONResult
+// @Router /health/startup [get]
+func (a *API) Startup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.respHealth(w, r, a.CheckHealth(r.Context(), ProbeStartup))
+	}
+}
@@ -0,0 +1,235 @@
+package go_base_api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// HealthCheckConfig declares a built-in health check in the `health` section of ApiServerConfig.
+type HealthCheckConfig struct {
+	Name           string   `json:"name" yaml:"name"`
+	Type           string   `json:"type" yaml:"type"`
+	Probes         []string `json:"probes" yaml:"probes"`
+	Address        string   `json:"address,omitempty" yaml:"address"`
+	URL            string   `json:"url,omitempty" yaml:"url"`
+	ExpectedStatus int      `json:"expected_status,omitempty" yaml:"expected_status"`
+	Host           string   `json:"host,omitempty" yaml:"host"`
+	Driver         string   `json:"driver,omitempty" yaml:"driver"`
+	DSN            string   `json:"-" yaml:"dsn"`
+	Path           string   `json:"path,omitempty" yaml:"path"`
+	MinFreeBytes   uint64   `json:"min_free_bytes,omitempty" yaml:"min_free_bytes"`
+}
+
+type tcpChecker struct{ name, address string }
+
+// NewTCPChecker checks that address (host:port) accepts TCP connections.
+func NewTCPChecker(name, address string) HealthChecker {
+	return tcpChecker{name: name, address: address}
+}
+
+func (c tcpChecker) Name() string { return c.name }
+func (c tcpChecker) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+type httpChecker struct {
+	name           string
+	url            string
+	expectedStatus int
+	client         *http.Client
+}
+
+// NewHTTPChecker checks that GET url answers with expectedStatus, any 2xx if expectedStatus is 0.
+func NewHTTPChecker(name, url string, expectedStatus int) HealthChecker {
+	return httpChecker{name: name, url: url, expectedStatus: expectedStatus, client: http.DefaultClient}
+}
+
+func (c httpChecker) Name() string { return c.name }
+func (c httpChecker) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if c.expectedStatus == 0 && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode != c.expectedStatus {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type dnsChecker struct{ name, host string }
+
+// NewDNSChecker checks that host resolves to at least one address.
+func NewDNSChecker(name, host string) HealthChecker {
+	return dnsChecker{name: name, host: host}
+}
+
+func (c dnsChecker) Name() string { return c.name }
+func (c dnsChecker) Check(ctx context.Context) error {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, c.host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no addresses for %s", c.host)
+	}
+	return nil
+}
+
+type sqlChecker struct {
+	name string
+	db   *sql.DB
+}
+
+// NewSQLChecker pings db.
+func NewSQLChecker(name string, db *sql.DB) HealthChecker {
+	return sqlChecker{name: name, db: db}
+}
+
+func (c sqlChecker) Name() string { return c.name }
+func (c sqlChecker) Check(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+type diskSpaceChecker struct {
+	name         string
+	path         string
+	minFreeBytes uint64
+}
+
+// NewDiskSpaceChecker checks that the filesystem of path has at least minFreeBytes available.
+func NewDiskSpaceChecker(name, path string, minFreeBytes uint64) HealthChecker {
+	return diskSpaceChecker{name: name, path: path, minFreeBytes: minFreeBytes}
+}
+
+func (c diskSpaceChecker) Name() string { return c.name }
+func (c diskSpaceChecker) Check(ctx context.Context) error {
+	free, err := diskFreeBytes(c.path)
+	if err != nil {
+		return err
+	}
+	if free < c.minFreeBytes {
+		return fmt.Errorf("%d bytes free on %s, want at least %d", free, c.path, c.minFreeBytes)
+	}
+	return nil
+}
+
+type fileExistsChecker struct{ name, path string }
+
+// NewFileExistsChecker checks that path exists.
+func NewFileExistsChecker(name, path string) HealthChecker {
+	return fileExistsChecker{name: name, path: path}
+}
+
+func (c fileExistsChecker) Name() string { return c.name }
+func (c fileExistsChecker) Check(ctx context.Context) error {
+	_, err := os.Stat(c.path)
+	return err
+}
+
+// NewHealthCheckerFromConfig builds a built-in checker declared in config.
+func NewHealthCheckerFromConfig(conf HealthCheckConfig) (HealthChecker, error) {
+	name := conf.Name
+	if name == "" {
+		name = conf.Type
+	}
+	switch strings.ToLower(conf.Type) {
+	case "tcp":
+		if conf.Address == "" {
+			return nil, fmt.Errorf("health check %s: address is required", name)
+		}
+		return NewTCPChecker(name, conf.Address), nil
+	case "http":
+		if conf.URL == "" {
+			return nil, fmt.Errorf("health check %s: url is required", name)
+		}
+		return NewHTTPChecker(name, conf.URL, conf.ExpectedStatus), nil
+	case "dns":
+		if conf.Host == "" {
+			return nil, fmt.Errorf("health check %s: host is required", name)
+		}
+		return NewDNSChecker(name, conf.Host), nil
+	case "sql":
+		db, err := sql.Open(conf.Driver, conf.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("health check %s: %w", name, err)
+		}
+		return NewSQLChecker(name, db), nil
+	case "disk":
+		path := conf.Path
+		if path == "" {
+			path = "/"
+		}
+		return NewDiskSpaceChecker(name, path, conf.MinFreeBytes), nil
+	case "file":
+		if conf.Path == "" {
+			return nil, fmt.Errorf("health check %s: path is required", name)
+		}
+		return NewFileExistsChecker(name, conf.Path), nil
+	}
+	return nil, fmt.Errorf("health check %s: unknown type %q", name, conf.Type)
+}
+
+// probeNames maps the probe names accepted in HealthCheckConfig.Probes.
+var probeNames = map[string]Probe{
+	"live":      ProbeLiveness,
+	"liveness":  ProbeLiveness,
+	"ready":     ProbeReadiness,
+	"readiness": ProbeReadiness,
+	"startup":   ProbeStartup,
+}
+
+// parseProbes converts probe names, rejecting unknown ones.
+func parseProbes(names []string) ([]Probe, error) {
+	probes := make([]Probe, 0, len(names))
+	for _, n := range names {
+		p, ok := probeNames[strings.ToLower(strings.TrimSpace(n))]
+		if !ok {
+			return nil, fmt.Errorf("unknown probe %q", n)
+		}
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
+
+// InitializeHealthChecks registers the checks declared in ApiServerConfig.HealthChecks.
+// A misconfigured check is logged and registered as always DOWN on readiness,
+// so a broken declaration cannot report the service ready.
+func (a *API) InitializeHealthChecks() {
+	for _, conf := range a.Config.HealthChecks {
+		name := conf.Name
+		if name == "" {
+			name = conf.Type
+		}
+		probes, probeErr := parseProbes(conf.Probes)
+		c, err := NewHealthCheckerFromConfig(conf)
+		if err == nil && probeErr != nil {
+			err = fmt.Errorf("health check %s: %w", name, probeErr)
+		}
+		if err != nil {
+			Log.Error(err)
+			misconfigured := err
+			// readiness only, a restart would not fix the config
+			c = NewHealthCheck(name, func(context.Context) error { return misconfigured })
+			probes = []Probe{ProbeReadiness}
+		}
+		a.AddHealthChecker(c, probes...)
+	}
+}
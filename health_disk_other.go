@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package go_base_api
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func diskFreeBytes(path string) (uint64, error) {
+	return 0, fmt.Errorf("disk space check is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,110 @@
+package go_base_api
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckHealth(t *testing.T) {
+	up := func(name string) HealthChecker {
+		return NewHealthCheck(name, func(context.Context) error { return nil })
+	}
+	down := func(name string) HealthChecker {
+		return NewHealthCheck(name, func(context.Context) error { return errors.New(name + " is down") })
+	}
+	type reg struct {
+		c      HealthChecker
+		probes []Probe
+	}
+	tests := []struct {
+		name   string
+		checks []reg
+		probes []Probe
+		status string
+		want   map[string]string
+	}{
+		{"no checks", nil, []Probe{ProbeReadiness}, HealthStatusUp, map[string]string{}},
+		{"all up", []reg{{up("db"), nil}, {up("cache"), nil}}, []Probe{ProbeReadiness}, HealthStatusUp,
+			map[string]string{"db": HealthStatusUp, "cache": HealthStatusUp}},
+		{"one down", []reg{{up("db"), nil}, {down("cache"), nil}}, []Probe{ProbeReadiness}, HealthStatusDown,
+			map[string]string{"db": HealthStatusUp, "cache": HealthStatusDown}},
+		{"other probe", []reg{{down("db"), []Probe{ProbeStartup}}}, []Probe{ProbeReadiness}, HealthStatusUp, map[string]string{}},
+		{"one registration on two probes", []reg{{up("db"), []Probe{ProbeLiveness, ProbeReadiness}}},
+			[]Probe{ProbeLiveness, ProbeReadiness}, HealthStatusUp, map[string]string{"db": HealthStatusUp}},
+		{"duplicate names", []reg{{up("tcp"), nil}, {down("tcp"), nil}, {up("tcp"), []Probe{ProbeReadiness, ProbeLiveness}}},
+			[]Probe{ProbeLiveness, ProbeReadiness}, HealthStatusDown,
+			map[string]string{"tcp": HealthStatusUp, "tcp-2": HealthStatusDown, "tcp-3": HealthStatusUp}},
+		{"panic", []reg{{NewHealthCheck("boom", func(context.Context) error { panic("boom") }), nil}},
+			[]Probe{ProbeReadiness}, HealthStatusDown, map[string]string{"boom": HealthStatusDown}},
+		{"timeout", []reg{{NewHealthCheck("slow", func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }), nil}},
+			[]Probe{ProbeReadiness}, HealthStatusDown, map[string]string{"slow": HealthStatusDown}},
+	}
+	for _, tt := range tests {
+		a := &API{}
+		a.Config.HealthTimeout = 1
+		for _, r := range tt.checks {
+			a.AddHealthChecker(r.c, r.probes...)
+		}
+		report := a.CheckHealth(context.Background(), tt.probes...)
+		if report.Status != tt.status {
+			t.Errorf("%s: status %s, want %s", tt.name, report.Status, tt.status)
+		}
+		got := map[string]string{}
+		for name, res := range report.Checks {
+			got[name] = res.Status
+			if res.Status == HealthStatusDown && res.Error == "" {
+				t.Errorf("%s: %s is down without error", tt.name, name)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: checks %v, want %v", tt.name, got, tt.want)
+		}
+		for name, status := range tt.want {
+			if got[name] != status {
+				t.Errorf("%s: %s is %q, want %q", tt.name, name, got[name], status)
+			}
+		}
+	}
+}
+
+func TestCheckHealthDraining(t *testing.T) {
+	a := &API{}
+	atomic.StoreInt32(&a.draining, 1)
+	if r := a.CheckHealth(context.Background(), ProbeReadiness); r.Status != HealthStatusDown || r.Checks["shutdown"].Status != HealthStatusDown {
+		t.Errorf("readiness while draining: %+v", r)
+	}
+	if r := a.CheckHealth(context.Background(), ProbeLiveness); r.Status != HealthStatusUp {
+		t.Errorf("liveness while draining: %+v", r)
+	}
+}
+
+func TestInitializeHealthChecks(t *testing.T) {
+	a := &API{}
+	a.Config.HealthChecks = []HealthCheckConfig{
+		{Type: "file", Path: "/"},
+		{Type: "file", Path: filepath.Join(t.TempDir(), "missing")},
+		{Name: "bogus", Type: "nope"},
+		{Name: "probe", Type: "file", Path: "/", Probes: []string{"sometimes"}},
+		{Name: "alive", Type: "file", Path: "/", Probes: []string{"liveness"}},
+	}
+	a.InitializeHealthChecks()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ready := a.CheckHealth(ctx, ProbeReadiness)
+	want := map[string]string{"file": HealthStatusUp, "file-2": HealthStatusDown, "bogus": HealthStatusDown, "probe": HealthStatusDown}
+	if ready.Status != HealthStatusDown || len(ready.Checks) != len(want) {
+		t.Fatalf("readiness: %+v", ready)
+	}
+	for name, status := range want {
+		if ready.Checks[name].Status != status {
+			t.Errorf("%s is %q, want %q", name, ready.Checks[name].Status, status)
+		}
+	}
+	if live := a.CheckHealth(ctx, ProbeLiveness); live.Status != HealthStatusUp || len(live.Checks) != 1 {
+		t.Errorf("liveness: %+v", live)
+	}
+}
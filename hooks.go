@@ -0,0 +1,118 @@
+package go_base_api
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Hook is a lifecycle func registered with OnStart or OnShutdown.
+type Hook func(ctx context.Context) error
+
+type shutdownFunc struct {
+	name    string
+	timeout time.Duration
+	fn      Hook
+}
+
+// RegisterShutdown adds work (closing DB pools, tracer providers, queues) to run
+// after the server is drained. Funcs run in reverse registration order, each
+// bounded by its own timeout (GracefulTimeout if timeout is 0). Funcs
+// registered by an OnStart hook also run when Start fails after that hook.
+func (a *API) RegisterShutdown(name string, timeout time.Duration, fn Hook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.shutdownFuncs = append(a.shutdownFuncs, shutdownFunc{name: name, timeout: timeout, fn: fn})
+}
+
+// OnStart registers a hook run by Start before the server listens. Hooks run in
+// registration order, a failing hook aborts startup. A hook that opens
+// resources registers their cleanup with RegisterShutdown itself, so it is
+// undone only when the hook succeeded.
+func (a *API) OnStart(fn Hook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.startHooks = append(a.startHooks, fn)
+}
+
+// OnShutdown registers a hook run after the server is drained, in reverse
+// registration order with GracefulTimeout each. See RegisterShutdown.
+func (a *API) OnShutdown(fn Hook) {
+	a.RegisterShutdown(hookName(fn), 0, fn)
+}
+
+func hookName(fn Hook) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "hook"
+}
+
+// runStartHooks runs the OnStart hooks and returns the shutdown funcs
+// registered by the hooks that succeeded, to be undone if startup fails.
+func (a *API) runStartHooks(ctx context.Context) ([]shutdownFunc, error) {
+	a.mu.Lock()
+	hooks := a.startHooks
+	from, to := len(a.shutdownFuncs), len(a.shutdownFuncs)
+	a.mu.Unlock()
+	registered := func() []shutdownFunc {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return append([]shutdownFunc(nil), a.shutdownFuncs[from:to]...)
+	}
+	for i, fn := range hooks {
+		name := hookName(fn)
+		start := time.Now()
+		if err := fn(ctx); err != nil {
+			Log.Errorf("start hook %d (%s) failed after %s: %v", i, name, time.Since(start), err)
+			return registered(), fmt.Errorf("start hook %d (%s): %w", i, name, err)
+		}
+		Log.Infof("start hook %d (%s) finished in %s", i, name, time.Since(start))
+		a.mu.Lock()
+		to = len(a.shutdownFuncs)
+		a.mu.Unlock()
+	}
+	return registered(), nil
+}
+
+// Draining reports whether the server is shutting down and no longer ready.
+func (a *API) Draining() bool {
+	return atomic.LoadInt32(&a.draining) == 1
+}
+
+func (a *API) runShutdownFuncs(ctx context.Context, funcs []shutdownFunc) error {
+	var firstErr error
+	for i := len(funcs) - 1; i >= 0; i-- {
+		if err := a.runShutdownFunc(ctx, funcs[i]); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (a *API) runShutdownFunc(ctx context.Context, f shutdownFunc) (err error) {
+	timeout := f.timeout
+	if timeout <= 0 {
+		timeout = time.Second * time.Duration(a.Config.GracefulTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if err == nil {
+			Log.Infof("shutdown %s finished in %s", f.name, time.Since(start))
+			return
+		}
+		Log.Errorf("shutdown %s failed after %s: %v", f.name, time.Since(start), err)
+		err = fmt.Errorf("shutdown %s: %w", f.name, err)
+	}()
+	return f.fn(ctx)
+}
@@ -0,0 +1,320 @@
+package go_base_api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefetchInterval bounds how often an unknown key ID triggers a fetch.
+const jwksRefetchInterval = 10 * time.Second
+
+type jwtKey struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+// matches reports whether k may verify a token with kid and alg.
+func (k jwtKey) matches(kid, alg string) bool {
+	return (k.kid == "" || kid == "" || k.kid == kid) && (k.alg == "" || k.alg == alg)
+}
+
+// jwtKeySet holds the static keys of JWTConfig and the cached keys of
+// JWKSURL. One fetch runs at a time, outside mu, so requests never wait on
+// the network while holding it.
+type jwtKeySet struct {
+	conf   JWTConfig
+	static []jwtKey
+	client *http.Client
+
+	mu       sync.RWMutex
+	remote   []jwtKey
+	fetched  time.Time
+	tried    time.Time
+	fetching chan struct{}
+}
+
+func newJWTKeySet(conf JWTConfig) *jwtKeySet {
+	ks := &jwtKeySet{conf: conf, client: &http.Client{Timeout: 5 * time.Second}}
+	if conf.Secret != "" {
+		ks.static = append(ks.static, jwtKey{key: []byte(conf.Secret)})
+	}
+	if conf.PublicKey != "" {
+		data, err := []byte(conf.PublicKey), error(nil)
+		if !strings.HasPrefix(strings.TrimSpace(conf.PublicKey), "-----BEGIN") {
+			data, err = os.ReadFile(conf.PublicKey)
+		}
+		var key interface{}
+		if err == nil {
+			key, err = parsePublicKeyPEM(data)
+		}
+		if err != nil {
+			Log.Errorf("Cannot load JWT public key: %v", err)
+		} else {
+			ks.static = append(ks.static, jwtKey{key: key})
+		}
+	}
+	if conf.JWKSFile != "" {
+		data, err := os.ReadFile(conf.JWKSFile)
+		if err == nil {
+			var keys []jwtKey
+			if keys, err = parseJWKS(data); err == nil {
+				ks.static = append(ks.static, keys...)
+			}
+		}
+		if err != nil {
+			Log.Errorf("Cannot load JWKS file %s: %v", conf.JWKSFile, err)
+		}
+	}
+	if len(ks.static) == 0 && conf.JWKSURL == "" {
+		Log.Error("JWT is enabled without keys, all tokens will be rejected")
+	}
+	return ks
+}
+
+// jwtKeys returns the key set created by InitializeJWT.
+func (a *API) jwtKeys() *jwtKeySet {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.jwks == nil {
+		a.jwks = newJWTKeySet(a.Config.JWT)
+	}
+	return a.jwks
+}
+
+// InitializeJWT loads the JWT keys and fetches JWKSURL once.
+func (a *API) InitializeJWT() {
+	ks := a.jwtKeys()
+	if ks.conf.JWKSURL != "" {
+		<-ks.refresh()
+	}
+}
+
+// lookup returns the keys that may verify a token with kid and alg. Stale
+// remote keys are fetched again in the background while the cached ones stay
+// in use; an unknown kid, or no remote keys at all, waits for the fetch.
+func (ks *jwtKeySet) lookup(ctx context.Context, kid, alg string) []interface{} {
+	var keys []interface{}
+	for _, k := range ks.static {
+		if k.matches(kid, alg) {
+			keys = append(keys, k.key)
+		}
+	}
+	if ks.conf.JWKSURL == "" {
+		return keys
+	}
+	ks.mu.RLock()
+	remote, fetched, tried := ks.remote, ks.fetched, ks.tried
+	ks.mu.RUnlock()
+	now := time.Now()
+	if now.Sub(tried) > jwksRefetchInterval {
+		found := false
+		for _, k := range remote {
+			found = found || k.kid == kid
+		}
+		if len(remote) == 0 || kid != "" && !found {
+			select {
+			case <-ks.refresh():
+			case <-ctx.Done():
+			}
+			ks.mu.RLock()
+			remote = ks.remote
+			ks.mu.RUnlock()
+		} else if now.Sub(fetched) > time.Duration(ks.conf.JWKSRefresh)*time.Second {
+			ks.refresh()
+		}
+	}
+	for _, k := range remote {
+		if k.matches(kid, alg) {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
+
+// refresh starts fetching JWKSURL unless a fetch is running and returns a
+// channel closed when it is done. The previous keys are kept on failure.
+func (ks *jwtKeySet) refresh() <-chan struct{} {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.fetching != nil {
+		return ks.fetching
+	}
+	done := make(chan struct{})
+	ks.fetching, ks.tried = done, time.Now()
+	go func() {
+		defer close(done)
+		// not bound to a request, the client timeout ends it
+		keys, err := ks.fetch(context.Background())
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+		ks.fetching = nil
+		if err != nil {
+			Log.Errorf("Cannot fetch JWKS %s: %v", ks.conf.JWKSURL, err)
+			return
+		}
+		ks.remote, ks.fetched = keys, time.Now()
+	}()
+	return done
+}
+
+func (ks *jwtKeySet) fetch(ctx context.Context) ([]jwtKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.conf.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+// parsePublicKeyPEM parses the first RSA or ECDSA public key or certificate in data.
+func parsePublicKeyPEM(data []byte) (interface{}, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no public key found")
+		}
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			return key, nil
+		}
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// parseJWKS parses the RSA, EC and oct signing keys of a JWK set, skipping
+// invalid keys and keys of other types or uses.
+func parseJWKS(data []byte) ([]jwtKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make([]jwtKey, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			Log.Errorf("Skipping JWK %q: %v", jwk.Kid, err)
+			continue
+		}
+		if key != nil {
+			keys = append(keys, jwtKey{kid: jwk.Kid, alg: jwk.Alg, key: key})
+		}
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	b64 := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, errors.New("invalid key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := b64(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(jwk.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := jwkCurves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := b64(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(k) == 0 {
+			return nil, errors.New("invalid key")
+		}
+		return k, nil
+	}
+	return nil, nil
+}
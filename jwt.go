@@ -0,0 +1,325 @@
+package go_base_api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// JWTConfig enables bearer token authentication on API.Router. Tokens are
+// verified with Secret (HS*), the PEM PublicKey (file path or inline PEM),
+// the keys of JWKSFile and the keys of JWKSURL, fetched again every
+// JWKSRefresh seconds or when an unknown key ID shows up. Algorithms limits
+// the accepted algorithms, all of HS/RS/ES 256/384/512 when empty. Tokens must
+// have an exp claim; exp, nbf and iat are checked with Leeway seconds of
+// clock skew, iss against Issuer and aud against Audience when set. Ignore
+// lists path prefixes or route names that need no token.
+type JWTConfig struct {
+	Enabled     bool     `json:"enabled" yaml:"enabled"`
+	Algorithms  []string `json:"algorithms" yaml:"algorithms"`
+	Secret      string   `json:"-" yaml:"secret"`
+	PublicKey   string   `json:"public_key" yaml:"public_key"`
+	JWKSFile    string   `json:"jwks_file" yaml:"jwks_file"`
+	JWKSURL     string   `json:"jwks_url" yaml:"jwks_url"`
+	JWKSRefresh int      `json:"jwks_refresh" yaml:"jwks_refresh"`
+	Issuer      string   `json:"issuer" yaml:"issuer"`
+	Audience    []string `json:"audience" yaml:"audience"`
+	Leeway      int      `json:"leeway" yaml:"leeway"`
+	Ignore      []string `json:"ignore" yaml:"ignore"`
+}
+
+// Claims are the claims of a verified token.
+type Claims map[string]interface{}
+
+// Subject returns the sub claim.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Issuer returns the iss claim.
+func (c Claims) Issuer() string {
+	s, _ := c["iss"].(string)
+	return s
+}
+
+// Audience returns the aud claim, a string or a list of strings.
+func (c Claims) Audience() []string {
+	return claimStrings(c["aud"])
+}
+
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// time returns the NumericDate claim name and whether it is set.
+func (c Claims) time(name string) (time.Time, bool, error) {
+	v, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, true, fmt.Errorf("%s is not a number", name)
+	}
+	sec, frac := int64(f), f-float64(int64(f))
+	return time.Unix(sec, int64(frac*1e9)), true, nil
+}
+
+type ctxKeyClaims struct{}
+
+// WithClaims returns a copy of ctx carrying the claims of the caller.
+func WithClaims(ctx context.Context, c Claims) context.Context {
+	return context.WithValue(ctx, ctxKeyClaims{}, c)
+}
+
+// ClaimsFrom returns the claims stored by an authenticator, or nil.
+func ClaimsFrom(ctx context.Context) Claims {
+	c, _ := ctx.Value(ctxKeyClaims{}).(Claims)
+	return c
+}
+
+var errTokenInvalid = errors.New("invalid token")
+
+var jwtHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// esCurveBits is the curve size of ES256 (P-256), ES384 (P-384) and ES512 (P-521).
+var esCurveBits = map[string]int{"256": 256, "384": 384, "512": 521}
+
+// verifySignature checks sig over signed with key for alg. The key type must
+// match the algorithm family, so a public key is never used as HMAC secret.
+func verifySignature(alg string, key interface{}, signed, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	hash, ok := jwtHashes[alg[2:]]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return errKeyType
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errTokenInvalid
+		}
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errKeyType
+		}
+		if rsa.VerifyPKCS1v15(pub, hash, digest, sig) != nil {
+			return errTokenInvalid
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errKeyType
+		}
+		bits := pub.Curve.Params().BitSize
+		if esCurveBits[alg[2:]] != bits {
+			return errKeyType
+		}
+		size := (bits + 7) / 8
+		if len(sig) != 2*size {
+			return errTokenInvalid
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errTokenInvalid
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	return nil
+}
+
+var errKeyType = errors.New("key does not match algorithm")
+
+// jwtAllowed reports whether alg is accepted by conf.
+func jwtAllowed(conf JWTConfig, alg string) bool {
+	if len(conf.Algorithms) == 0 {
+		return alg != "none"
+	}
+	for _, a := range conf.Algorithms {
+		if strings.EqualFold(a, alg) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseToken verifies the signature and the registered claims of token and
+// returns its claims.
+func (a *API) ParseToken(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", errTokenInvalid)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", errTokenInvalid)
+	}
+	if !jwtAllowed(a.Config.JWT, header.Alg) {
+		return nil, fmt.Errorf("%w: algorithm %q is not allowed", errTokenInvalid, header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", errTokenInvalid)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range a.jwtKeys().lookup(ctx, header.Kid, header.Alg) {
+		if verifySignature(header.Alg, key, signed, sig) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("%w: signature verification failed", errTokenInvalid)
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", errTokenInvalid)
+	}
+	if err := a.validateClaims(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", errTokenInvalid, err)
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// validateClaims checks exp, nbf, iat, iss and aud at now.
+func (a *API) validateClaims(c Claims, now time.Time) error {
+	conf := a.Config.JWT
+	leeway := time.Duration(conf.Leeway) * time.Second
+	exp, ok, err := c.time("exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if !now.Before(exp.Add(leeway)) {
+		return errors.New("token is expired")
+	}
+	if nbf, ok, err := c.time("nbf"); err != nil {
+		return err
+	} else if ok && now.Add(leeway).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+	if iat, ok, err := c.time("iat"); err != nil {
+		return err
+	} else if ok && now.Add(leeway).Before(iat) {
+		return errors.New("token is issued in the future")
+	}
+	if conf.Issuer != "" && c.Issuer() != conf.Issuer {
+		return errors.New("unexpected issuer")
+	}
+	if len(conf.Audience) > 0 {
+		for _, aud := range c.Audience() {
+			for _, want := range conf.Audience {
+				if aud == want {
+					return nil
+				}
+			}
+		}
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// JWTAuth requires a valid bearer token on every route not in JWT.Ignore
+// and not guarded by InternalAccess, unless an earlier authenticator
+// (APIKeyAuth) already stored claims. The claims are stored with WithClaims
+// and the sub claim with WithSubject. Failures get 401 with a
+// WWW-Authenticate challenge in the standard error envelope.
+func (a *API) JWTAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := ""
+		if route := mux.CurrentRoute(req); route != nil {
+			name = route.GetName()
+		}
+		if _, ignored := matchRoute(a.Config.JWT.Ignore, req.URL.Path, name); ignored || ClaimsFrom(req.Context()) != nil || a.internalRoute(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		token, ok := bearerToken(req)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, a.Config.App))
+			a.Error(w, req, &APIError{Status: http.StatusUnauthorized, Detail: "bearer token is required", Err: ErrUnauthorized})
+			return
+		}
+		claims, err := a.ParseToken(req.Context(), token)
+		if err != nil {
+			LoggerFrom(req.Context()).Debugf("%s %s: %v", req.Method, req.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="invalid_token", error_description=%q`, a.Config.App, err.Error()))
+			a.Error(w, req, &APIError{Status: http.StatusUnauthorized, Detail: err.Error(), Err: ErrUnauthorized})
+			return
+		}
+		ctx := WithClaims(req.Context(), claims)
+		if sub := claims.Subject(); sub != "" {
+			ctx = WithSubject(ctx, sub)
+			oteltrace.SpanFromContext(ctx).SetAttributes(semconv.EnduserIDKey.String(sub))
+			SetAccessLogField(ctx, "subject", sub)
+		}
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
@@ -0,0 +1,345 @@
+package go_base_api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+// signToken returns a token with header and claims signed by key for alg.
+func signToken(t *testing.T, header map[string]interface{}, claims Claims, key interface{}) string {
+	t.Helper()
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(header) + "." + enc(claims)
+	alg, _ := header["alg"].(string)
+	if alg == "none" {
+		return signed + "."
+	}
+	hash := jwtHashes[alg[2:]]
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(hash.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() Claims {
+	return Claims{"sub": "alice", "exp": float64(time.Now().Add(time.Hour).Unix())}
+}
+
+func TestVerifySignature(t *testing.T) {
+	signed := []byte("header.payload")
+	mac := func(alg string, secret []byte) []byte {
+		m := hmac.New(jwtHashes[alg[2:]].New, secret)
+		m.Write(signed)
+		return m.Sum(nil)
+	}
+	rsaSig := func(hash crypto.Hash) []byte {
+		h := hash.New()
+		h.Write(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, testRSAKey, hash, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	ecSig := func() []byte {
+		h := crypto.SHA256.New()
+		h.Write(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, testECKey, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+	secret := []byte("secret")
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&testRSAKey.PublicKey)})
+	tests := []struct {
+		name string
+		alg  string
+		key  interface{}
+		sig  []byte
+		err  error
+	}{
+		{"HS256", "HS256", secret, mac("HS256", secret), nil},
+		{"HS512", "HS512", secret, mac("HS512", secret), nil},
+		{"HS256 wrong secret", "HS256", []byte("other"), mac("HS256", secret), errTokenInvalid},
+		{"HS256 truncated", "HS256", secret, mac("HS256", secret)[:16], errTokenInvalid},
+		{"RS256", "RS256", &testRSAKey.PublicKey, rsaSig(crypto.SHA256), nil},
+		{"RS384", "RS384", &testRSAKey.PublicKey, rsaSig(crypto.SHA384), nil},
+		{"RS256 hash mismatch", "RS256", &testRSAKey.PublicKey, rsaSig(crypto.SHA384), errTokenInvalid},
+		{"ES256", "ES256", &testECKey.PublicKey, ecSig(), nil},
+		{"ES256 bad length", "ES256", &testECKey.PublicKey, ecSig()[:63], errTokenInvalid},
+		{"ES384 with P-256 key", "ES384", &testECKey.PublicKey, ecSig(), errKeyType},
+		{"RSA key as HMAC secret", "HS256", &testRSAKey.PublicKey, mac("HS256", rsaPEM), errKeyType},
+		{"secret for RS256", "RS256", rsaPEM, mac("HS256", rsaPEM), errKeyType},
+		{"EC key for RS", "RS256", &testECKey.PublicKey, ecSig(), errKeyType},
+		{"RSA key for ES", "ES256", &testRSAKey.PublicKey, ecSig(), errKeyType},
+	}
+	for _, tt := range tests {
+		err := verifySignature(tt.alg, tt.key, signed, tt.sig)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	for _, alg := range []string{"none", "HS1", "PS256", "HS257", "XX256"} {
+		if err := verifySignature(alg, secret, signed, nil); err == nil || !strings.Contains(err.Error(), "unsupported algorithm") {
+			t.Errorf("%s: got %v", alg, err)
+		}
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	pub, err := x509.MarshalPKIXPublicKey(&testRSAKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	a := &API{}
+	a.Config.JWT = JWTConfig{
+		Enabled:   true,
+		Secret:    "secret",
+		PublicKey: string(pubPEM),
+		Issuer:    "https://sso.example.com",
+		Audience:  []string{"orders"},
+		Leeway:    5,
+	}
+	now := time.Now()
+	claims := func(edit func(Claims)) Claims {
+		c := Claims{"sub": "alice", "iss": "https://sso.example.com", "aud": []string{"billing", "orders"},
+			"exp": float64(now.Add(time.Hour).Unix()), "iat": float64(now.Unix())}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	hs := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	rs := map[string]interface{}{"alg": "RS256"}
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"HS256", signToken(t, hs, claims(nil), []byte("secret")), ""},
+		{"RS256", signToken(t, rs, claims(nil), testRSAKey), ""},
+		{"aud string", signToken(t, hs, claims(func(c Claims) { c["aud"] = "orders" }), []byte("secret")), ""},
+		{"expired within leeway", signToken(t, hs, claims(func(c Claims) { c["exp"] = float64(now.Add(-2 * time.Second).Unix()) }), []byte("secret")), ""},
+		{"wrong secret", signToken(t, hs, claims(nil), []byte("guess")), "signature verification failed"},
+		{"public key as HMAC secret", signToken(t, hs, claims(nil), pubPEM), "signature verification failed"},
+		{"alg none", signToken(t, map[string]interface{}{"alg": "none"}, claims(nil), nil), `algorithm "none" is not allowed`},
+		{"expired", signToken(t, hs, claims(func(c Claims) { c["exp"] = float64(now.Add(-time.Minute).Unix()) }), []byte("secret")), "token is expired"},
+		{"no exp", signToken(t, hs, claims(func(c Claims) { delete(c, "exp") }), []byte("secret")), "token has no expiry"},
+		{"exp not a number", signToken(t, hs, claims(func(c Claims) { c["exp"] = "tomorrow" }), []byte("secret")), "exp is not a number"},
+		{"not yet valid", signToken(t, hs, claims(func(c Claims) { c["nbf"] = float64(now.Add(time.Minute).Unix()) }), []byte("secret")), "token is not valid yet"},
+		{"issued in the future", signToken(t, hs, claims(func(c Claims) { c["iat"] = float64(now.Add(time.Minute).Unix()) }), []byte("secret")), "token is issued in the future"},
+		{"wrong issuer", signToken(t, hs, claims(func(c Claims) { c["iss"] = "https://evil.example.com" }), []byte("secret")), "unexpected issuer"},
+		{"wrong audience", signToken(t, hs, claims(func(c Claims) { c["aud"] = "billing" }), []byte("secret")), "unexpected audience"},
+		{"malformed", "abc.def", "malformed token"},
+		{"bad header", "!!.e30.sig", "malformed header"},
+	}
+	for _, tt := range tests {
+		got, err := a.ParseToken(context.Background(), tt.token)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err == "" && got.Subject() != "alice":
+			t.Errorf("%s: subject %q", tt.name, got.Subject())
+		case tt.err != "" && (err == nil || !errors.Is(err, errTokenInvalid) || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// tampering with the claims breaks the signature
+	parts := strings.Split(signToken(t, hs, claims(nil), []byte("secret")), ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999}`))
+	if _, err := a.ParseToken(context.Background(), strings.Join(parts, ".")); err == nil {
+		t.Error("tampered token accepted")
+	}
+
+	a = &API{}
+	a.Config.JWT = JWTConfig{Enabled: true, Secret: "secret", Algorithms: []string{"RS256"}}
+	if _, err := a.ParseToken(context.Background(), signToken(t, hs, claims(nil), []byte("secret"))); err == nil {
+		t.Error("HS256 accepted with algorithms [RS256]")
+	}
+}
+
+func jwkOf(kid string, key interface{}) map[string]string {
+	b64 := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "alg": "RS256", "n": b64(k.N), "e": b64(big.NewInt(int64(k.E)))}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X), "y": b64(k.Y)}
+	}
+	return nil
+}
+
+func TestJWKS(t *testing.T) {
+	var fetches int32
+	keys := []map[string]string{jwkOf("rsa-1", &testRSAKey.PublicKey)}
+	var block chan struct{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if block != nil {
+			<-block
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer srv.Close()
+
+	a := &API{}
+	a.Config.JWT = JWTConfig{Enabled: true, JWKSURL: srv.URL, JWKSRefresh: 300}
+	a.InitializeJWT()
+	for i := 0; i < 3; i++ {
+		tok := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-1"}, validClaims(), testRSAKey)
+		if _, err := a.ParseToken(context.Background(), tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("fetched %d times, want 1", n)
+	}
+
+	// a new kid is fetched right away, once per refetch interval
+	keys = append(keys, jwkOf("ec-1", &testECKey.PublicKey))
+	ec := signToken(t, map[string]interface{}{"alg": "ES256", "kid": "ec-1"}, validClaims(), testECKey)
+	ks := a.jwtKeys()
+	ks.mu.Lock()
+	ks.tried = time.Now().Add(-jwksRefetchInterval - time.Second)
+	ks.mu.Unlock()
+	if _, err := a.ParseToken(context.Background(), ec); err != nil {
+		t.Fatal(err)
+	}
+	unknown := signToken(t, map[string]interface{}{"alg": "ES256", "kid": "ec-2"}, validClaims(), testECKey)
+	if _, err := a.ParseToken(context.Background(), unknown); err == nil {
+		t.Fatal("unknown kid accepted")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Fatalf("fetched %d times, want 2", n)
+	}
+
+	// stale keys stay in use while a slow fetch runs in the background
+	block = make(chan struct{})
+	ks.mu.Lock()
+	ks.fetched = time.Now().Add(-time.Hour)
+	ks.tried = ks.fetched
+	ks.mu.Unlock()
+	rs := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-1"}, validClaims(), testRSAKey)
+	for i := 0; i < 3; i++ {
+		if _, err := a.ParseToken(context.Background(), rs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ks.mu.RLock()
+	running := ks.fetching
+	ks.mu.RUnlock()
+	if running == nil {
+		t.Fatal("no background fetch")
+	}
+	close(block)
+	<-running
+	if n := atomic.LoadInt32(&fetches); n != 3 {
+		t.Fatalf("fetched %d times, want 3", n)
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	a := &API{}
+	a.Config.App = "test"
+	a.Config.JWT = JWTConfig{Enabled: true, Secret: "secret", Ignore: []string{"/health"}}
+	a.Config.InternalAuth = InternalAuthConfig{BasicUsers: map[string]string{"ops": "pass"}}
+	var subject string
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { subject = SubjectFrom(r.Context()) })
+	r := mux.NewRouter()
+	r.Use(a.JWTAuth)
+	r.Handle("/orders", ok)
+	r.Handle("/health", ok)
+	r.Handle("/health/live", ok)
+	r.Handle("/healthcare/records", ok)
+	a.describeRoute(r.Handle("/env", a.InternalAccess(ok)), internalAccessPolicy)
+
+	tests := []struct {
+		name, path, auth string
+		status           int
+	}{
+		{"valid token", "/orders", "Bearer " + signToken(t, map[string]interface{}{"alg": "HS256"}, validClaims(), []byte("secret")), 200},
+		{"no token", "/orders", "", 401},
+		{"basic auth", "/orders", "Basic b3BzOnBhc3M=", 401},
+		{"bad token", "/orders", "Bearer abc.def.ghi", 401},
+		{"ignored", "/health", "", 200},
+		{"ignored subpath", "/health/live", "", 200},
+		{"path sharing the ignored prefix", "/healthcare/records", "", 401},
+		{"internal route with basic auth", "/env", "Basic b3BzOnBhc3M=", 200},
+		{"internal route without credentials", "/env", "", 401},
+	}
+	for _, tt := range tests {
+		subject = ""
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.status, rec.Body)
+		}
+		if rec.Code == 401 && tt.path == "/orders" && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer ") {
+			t.Errorf("%s: WWW-Authenticate %q", tt.name, rec.Header().Get("WWW-Authenticate"))
+		}
+		if tt.name == "valid token" && subject != "alice" {
+			t.Errorf("%s: subject %q", tt.name, subject)
+		}
+	}
+}
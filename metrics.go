@@ -0,0 +1,218 @@
+package go_base_api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	muxprom "gitlab.com/msvechla/mux-prometheus/pkg/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// registerer returns Config.Registerer or the default registry.
+func (a *API) registerer() prometheus.Registerer {
+	if a.Config.Registerer != nil {
+		return a.Config.Registerer
+	}
+	return prometheus.DefaultRegisterer
+}
+
+// gatherer returns Config.Gatherer, the custom Registerer if it can gather
+// (e.g. *prometheus.Registry) or the default registry.
+func (a *API) gatherer() prometheus.Gatherer {
+	if a.Config.Gatherer != nil {
+		return a.Config.Gatherer
+	}
+	if g, ok := a.Config.Registerer.(prometheus.Gatherer); ok {
+		return g
+	}
+	return prometheus.DefaultGatherer
+}
+
+// registerCollector registers c in the configured registry. If an identical
+// collector is already registered (e.g. by another API in the same process)
+// the existing one is returned instead.
+func (a *API) registerCollector(c prometheus.Collector) prometheus.Collector {
+	if err := a.registerer().Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector
+		}
+		Log.Error("Cannot register collector: ", err)
+	}
+	return c
+}
+
+var (
+	muxInstrumentationsMu sync.Mutex
+	muxInstrumentations   = map[prometheus.Registerer]*muxprom.Instrumentation{}
+)
+
+// muxInstrumentation returns the mux_router_* middleware for the configured
+// registry. It registers its collectors with MustRegister, so APIs sharing a
+// registry share one instance instead of panicking.
+func (a *API) muxInstrumentation() *muxprom.Instrumentation {
+	reg := a.registerer()
+	muxInstrumentationsMu.Lock()
+	defer muxInstrumentationsMu.Unlock()
+	if i, ok := muxInstrumentations[reg]; ok {
+		return i
+	}
+	i := muxprom.NewCustomInstrumentation(true, "mux", "router", prometheus.DefBuckets, nil, reg)
+	muxInstrumentations[reg] = i
+	return i
+}
+
+// metricsHandler serves the configured gatherer on MetricsPath.
+func (a *API) metricsHandler() http.Handler {
+	if a.Config.GoCollector {
+		a.registerCollector(collectors.NewGoCollector())
+	}
+	if a.Config.ProcessCollector {
+		a.registerCollector(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	handler := promhttp.InstrumentMetricHandler(a.registerer(),
+		promhttp.HandlerFor(a.gatherer(), promhttp.HandlerOpts{ErrorLog: Log}))
+	return otelhttp.NewHandler(handler, "Prometheus")
+}
+
+// UnmatchedRoute is the route label of requests no route matched.
+const UnmatchedRoute = "unmatched"
+
+// redMetrics are the request rate, errors and duration (plus in-flight and
+// size) collectors labelled by route template, method and status class.
+type redMetrics struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+	reqSize  *prometheus.HistogramVec
+	respSize *prometheus.HistogramVec
+}
+
+var metricNameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// metricsNamespace returns MetricsNamespace or App made a valid metric name.
+func (a *API) metricsNamespace() string {
+	ns := a.Config.MetricsNamespace
+	if ns == "" {
+		ns = a.Config.App
+	}
+	ns = metricNameRe.ReplaceAllString(ns, "_")
+	if ns != "" && ns[0] >= '0' && ns[0] <= '9' {
+		ns = "_" + ns
+	}
+	return ns
+}
+
+func (a *API) newREDMetrics() *redMetrics {
+	ns := a.metricsNamespace()
+	labels := []string{"route", "method", "status"}
+	return &redMetrics{
+		requests: a.registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "http", Name: "requests_total",
+			Help: "The total number of HTTP requests by route, method and status class.",
+		}, labels)).(*prometheus.CounterVec),
+		errors: a.registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Subsystem: "http", Name: "request_errors_total",
+			Help: "The total number of HTTP requests answered with 5xx.",
+		}, labels)).(*prometheus.CounterVec),
+		duration: a.registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "Duration of HTTP requests in seconds.",
+			Buckets: a.Config.MetricsBuckets,
+		}, labels)).(*prometheus.HistogramVec),
+		inFlight: a.registerCollector(prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: ns, Subsystem: "http", Name: "requests_in_flight",
+			Help: "Number of HTTP requests being served.",
+		})).(prometheus.Gauge),
+		reqSize: a.registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns, Subsystem: "http", Name: "request_size_bytes",
+			Help:    "Size of HTTP request bodies in bytes.",
+			Buckets: a.Config.MetricsSizeBuckets,
+		}, labels)).(*prometheus.HistogramVec),
+		respSize: a.registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns, Subsystem: "http", Name: "response_size_bytes",
+			Help:    "Size of HTTP response bodies in bytes.",
+			Buckets: a.Config.MetricsSizeBuckets,
+		}, labels)).(*prometheus.HistogramVec),
+	}
+}
+
+type ctxKeyRoute struct{}
+
+// routeHolder carries the route template from the router middleware back to
+// the outer metrics wrapper.
+type routeHolder struct {
+	route string
+}
+
+// countingBody counts the request body bytes read by the handler.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Metrics wraps a router and records RED metrics for every request, with the
+// route label set by routeLabel or UnmatchedRoute.
+func (a *API) Metrics(next http.Handler) http.Handler {
+	if a.red == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		holder := &routeHolder{route: UnmatchedRoute}
+		body := &countingBody{ReadCloser: req.Body}
+		if req.Body != nil && req.Body != http.NoBody {
+			req.Body = body
+		}
+		a.red.inFlight.Inc()
+		defer a.red.inFlight.Dec()
+		rec, ww := recordResponse(w)
+		next.ServeHTTP(ww, req.WithContext(context.WithValue(req.Context(), ctxKeyRoute{}, holder)))
+
+		method := req.Method
+		if !knownMethods[method] {
+			method = "OTHER"
+		}
+		labels := prometheus.Labels{"route": holder.route, "method": method, "status": statusClass(rec.status)}
+		a.red.requests.With(labels).Inc()
+		if rec.status >= http.StatusInternalServerError {
+			a.red.errors.With(labels).Inc()
+		}
+		a.red.duration.With(labels).Observe(time.Since(start).Seconds())
+		a.red.reqSize.With(labels).Observe(float64(body.n))
+		a.red.respSize.With(labels).Observe(float64(rec.written))
+	})
+}
+
+// routeLabel is the router middleware that reports the matched route template to Metrics.
+func (a *API) routeLabel(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if holder, ok := req.Context().Value(ctxKeyRoute{}).(*routeHolder); ok {
+			if tpl := routeTemplate(req); tpl != "" {
+				holder.route = tpl
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,35 @@
+package go_base_api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestInitializePrometheusSharedRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	apis := make([]*API, 2)
+	for i := range apis {
+		a := &API{Router: mux.NewRouter()}
+		a.Management = a.Router
+		a.Config.App = "test"
+		a.Config.Prometheus = true
+		a.Config.MetricsPath = "/prometheus"
+		a.Config.Registerer = reg
+		a.InitializePrometheus()
+		a.Router.HandleFunc("/orders", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+		apis[i] = a
+	}
+	for _, a := range apis {
+		a.Router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	}
+	rec := httptest.NewRecorder()
+	apis[1].Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/prometheus", nil))
+	if !strings.Contains(rec.Body.String(), `mux_router_requests_total{code="204",host="example.com",method="GET",route="/orders"} 2`) {
+		t.Errorf("requests of both APIs not counted:\n%s", rec.Body)
+	}
+}
@@ -0,0 +1,120 @@
+package go_base_api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	PayloadOff      = "off"
+	PayloadTruncate = "truncate"
+	PayloadHash     = "hash"
+	PayloadFields   = "fields"
+)
+
+// SpanPayloadConfig controls how request and response payloads are recorded
+// in span attributes: not at all, as JSON truncated to MaxBytes, as a SHA-256
+// hash, or as JSON with only the Fields paths (dotted, e.g. "data.id") kept.
+type SpanPayloadConfig struct {
+	Mode     string   `json:"mode" yaml:"mode"`
+	MaxBytes int      `json:"max_bytes" yaml:"max_bytes"`
+	Fields   []string `json:"fields" yaml:"fields"`
+}
+
+// setPayload records the redacted v in span under key following SpanPayload,
+// plus its JSON size as key.size. Nothing is computed when the span is not recording.
+func (a *API) setPayload(span oteltrace.Span, key string, v interface{}) {
+	conf := a.Config.SpanPayload
+	if span == nil || !span.IsRecording() || conf.Mode == PayloadOff {
+		return
+	}
+	v = a.Redact(v)
+	raw, err := json.Marshal(v)
+	if err != nil {
+		span.RecordError(err)
+		return
+	}
+	span.SetAttributes(attribute.Int(key+".size", len(raw)))
+	switch conf.Mode {
+	case PayloadHash:
+		sum := sha256.Sum256(raw)
+		span.SetAttributes(attribute.String(key, "sha256:"+hex.EncodeToString(sum[:])))
+	case PayloadFields:
+		g, err := toGeneric(v)
+		if err != nil {
+			span.RecordError(err)
+			return
+		}
+		if raw, err = json.Marshal(pickFields(g, conf.Fields)); err != nil {
+			span.RecordError(err)
+			return
+		}
+		span.SetAttributes(attribute.String(key, truncatePayload(raw, conf.MaxBytes)))
+	default:
+		span.SetAttributes(attribute.String(key, truncatePayload(raw, conf.MaxBytes)))
+	}
+}
+
+// truncatePayload cuts raw to max bytes on a rune boundary, max <= 0 means no limit.
+func truncatePayload(raw []byte, max int) string {
+	if max <= 0 || len(raw) <= max {
+		return string(raw)
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(raw[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(%d bytes truncated)", raw[:cut], len(raw)-cut)
+}
+
+// pickFields returns the parts of g (as produced by toGeneric) selected by the
+// dotted paths. Arrays are traversed transparently.
+func pickFields(g interface{}, paths []string) interface{} {
+	var out interface{}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		out = mergePath(out, g, strings.Split(p, "."))
+	}
+	if out == nil {
+		return map[string]interface{}{}
+	}
+	return out
+}
+
+func mergePath(dst, src interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return src
+	}
+	switch val := src.(type) {
+	case map[string]interface{}:
+		item, ok := val[path[0]]
+		if !ok {
+			return dst
+		}
+		m, _ := dst.(map[string]interface{})
+		if m == nil {
+			m = map[string]interface{}{}
+		}
+		m[path[0]] = mergePath(m[path[0]], item, path[1:])
+		return m
+	case []interface{}:
+		s, _ := dst.([]interface{})
+		if len(s) != len(val) {
+			s = make([]interface{}, len(val))
+		}
+		for i, item := range val {
+			s[i] = mergePath(s[i], item, path)
+		}
+		return s
+	}
+	return dst
+}
@@ -0,0 +1,204 @@
+package go_base_api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Policy is an authorization requirement on the claims stored by an
+// authenticator (see WithClaims). Name describes it in RoutePolicies.
+type Policy struct {
+	Name  string
+	Check func(c Claims) (ok bool, reason string)
+}
+
+// Scopes returns the scopes of the scope claim (space separated) or the scp
+// claim (string or list).
+func (c Claims) Scopes() []string {
+	if s, ok := c["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	if s, ok := c["scp"].(string); ok {
+		return strings.Fields(s)
+	}
+	return claimStrings(c["scp"])
+}
+
+// Roles returns the roles claim, a string or a list of strings.
+func (c Claims) Roles() []string {
+	return claimStrings(c["roles"])
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScopes allows callers having all of scopes.
+func RequireScopes(scopes ...string) Policy {
+	return Policy{
+		Name: "scopes(" + strings.Join(scopes, ",") + ")",
+		Check: func(c Claims) (bool, string) {
+			granted := c.Scopes()
+			for _, s := range scopes {
+				if !contains(granted, s) {
+					return false, "missing scope " + s
+				}
+			}
+			return true, ""
+		},
+	}
+}
+
+// RequireRole allows callers having any of roles.
+func RequireRole(roles ...string) Policy {
+	return Policy{
+		Name: "role(" + strings.Join(roles, "|") + ")",
+		Check: func(c Claims) (bool, string) {
+			granted := c.Roles()
+			for _, r := range roles {
+				if contains(granted, r) {
+					return true, ""
+				}
+			}
+			return false, "requires role " + strings.Join(roles, " or ")
+		},
+	}
+}
+
+// Protect requires all policies on route, which must already have its
+// handler, it panics otherwise. Callers without claims get 401, callers
+// failing a policy 403 with the reason. The decision is recorded on the span
+// as authz.* attributes.
+//
+//	a.Protect(a.Router.HandleFunc("/orders", h).Methods(http.MethodPost), api.RequireScopes("orders:write"))
+func (a *API) Protect(route *mux.Route, policies ...Policy) *mux.Route {
+	next := route.GetHandler()
+	if next == nil {
+		tpl, _ := route.GetPathTemplate()
+		panic(fmt.Sprintf("api: Protect on route %q without a handler", tpl))
+	}
+	names := make([]string, len(policies))
+	for i, p := range policies {
+		names[i] = p.Name
+	}
+	a.describeRoute(route, names...)
+	return route.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		span := oteltrace.SpanFromContext(req.Context())
+		span.SetAttributes(attribute.StringSlice("authz.policies", names))
+		claims := ClaimsFrom(req.Context())
+		if claims == nil {
+			span.SetAttributes(attribute.String("authz.decision", "deny"), attribute.String("authz.reason", "unauthenticated"))
+			a.Error(w, req, &APIError{Status: http.StatusUnauthorized, Detail: "authentication is required", Err: ErrUnauthorized})
+			return
+		}
+		for _, p := range policies {
+			if ok, reason := p.Check(claims); !ok {
+				span.SetAttributes(attribute.String("authz.decision", "deny"), attribute.String("authz.policy", p.Name), attribute.String("authz.reason", reason))
+				a.Error(w, req, &APIError{Status: http.StatusForbidden, Detail: reason, Err: ErrForbidden})
+				return
+			}
+		}
+		span.SetAttributes(attribute.String("authz.decision", "allow"))
+		next.ServeHTTP(w, req)
+	}))
+}
+
+// describeRoute records names as protecting route for RoutePolicies.
+func (a *API) describeRoute(route *mux.Route, names ...string) *mux.Route {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.policies == nil {
+		a.policies = map[*mux.Route][]string{}
+	}
+	a.policies[route] = append(a.policies[route], names...)
+	return route
+}
+
+// RoutePolicy describes the policies protecting one route.
+type RoutePolicy struct {
+	Router   string   `json:"router"`
+	Name     string   `json:"name,omitempty"`
+	Path     string   `json:"path"`
+	Methods  []string `json:"methods,omitempty"`
+	Policies []string `json:"policies"`
+}
+
+// RoutePolicies lists every route of Router and Management with the
+// authenticators of Router ("api_key", "jwt", "api_key|jwt" when either
+// will do) and the policies added by Protect, for security review. Routes
+// without any have none.
+func (a *API) RoutePolicies() []RoutePolicy {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var list []RoutePolicy
+	for i, r := range a.routers() {
+		name := "public"
+		if i > 0 {
+			name = "management"
+		}
+		var routes []RoutePolicy
+		err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			if route.GetHandler() == nil {
+				return nil
+			}
+			tpl, err := route.GetPathTemplate()
+			if err != nil {
+				tpl = fmt.Sprintf("<%v>", err)
+			}
+			methods, _ := route.GetMethods()
+			policies := []string{}
+			if i == 0 {
+				policies = append(policies, a.authenticators(route, tpl)...)
+			}
+			routes = append(routes, RoutePolicy{
+				Router:   name,
+				Name:     route.GetName(),
+				Path:     tpl,
+				Methods:  methods,
+				Policies: append(policies, a.policies[route]...),
+			})
+			return nil
+		})
+		if err != nil {
+			Log.Error(err)
+		}
+		sort.SliceStable(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+		list = append(list, routes...)
+	}
+	return list
+}
+
+// authenticators returns the names of the authenticators of Router that
+// require credentials on route, which has the path template tpl. a.mu must
+// be held.
+func (a *API) authenticators(route *mux.Route, tpl string) []string {
+	if contains(a.policies[route], internalAccessPolicy) {
+		return nil
+	}
+	var names []string
+	if conf := a.Config.APIKeys; conf.Enabled {
+		if _, ignored := matchRoute(conf.Ignore, tpl, route.GetName()); !ignored {
+			names = append(names, "api_key")
+		}
+	}
+	if conf := a.Config.JWT; conf.Enabled {
+		if _, ignored := matchRoute(conf.Ignore, tpl, route.GetName()); !ignored {
+			names = append(names, "jwt")
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return []string{strings.Join(names, "|")}
+}
@@ -0,0 +1,80 @@
+package go_base_api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestProtect(t *testing.T) {
+	a := &API{}
+	r := mux.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if sub := req.Header.Get("X-Sub"); sub != "" {
+				req = req.WithContext(WithClaims(req.Context(), Claims{"sub": sub, "scope": req.Header.Get("X-Scope"), "roles": []interface{}{"auditor"}}))
+			}
+			next.ServeHTTP(w, req)
+		})
+	})
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	a.Protect(r.Handle("/orders", ok), RequireScopes("orders:read", "orders:write"))
+	a.Protect(r.Handle("/audit", ok), RequireRole("admin", "auditor"))
+	a.Protect(r.Handle("/admin", ok), RequireRole("admin"))
+
+	for _, tt := range []struct {
+		path, sub, scope string
+		status           int
+	}{
+		{"/orders", "", "", 401},
+		{"/orders", "alice", "orders:read", 403},
+		{"/orders", "alice", "orders:write orders:read", 200},
+		{"/audit", "alice", "", 200},
+		{"/admin", "alice", "", 403},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("X-Sub", tt.sub)
+		req.Header.Set("X-Scope", tt.scope)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s %q: status %d, want %d", tt.path, tt.sub, tt.scope, rec.Code, tt.status)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Protect on a route without handler did not panic")
+		}
+	}()
+	a.Protect(r.Path("/reports").Methods(http.MethodGet), RequireRole("admin"))
+}
+
+func TestRoutePolicies(t *testing.T) {
+	a := &API{Router: mux.NewRouter()}
+	a.Management = a.Router
+	a.Config.JWT = JWTConfig{Enabled: true, Ignore: []string{"/health", "/public/"}}
+	a.Config.APIKeys = APIKeyConfig{Enabled: true, Ignore: []string{"/health", "login"}}
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	a.Router.Handle("/health", ok)
+	a.Router.Handle("/public/docs", ok)
+	a.Router.Handle("/login", ok).Name("login")
+	a.Router.Handle("/orders", ok).Methods(http.MethodGet)
+	a.Protect(a.Router.Handle("/orders", ok).Methods(http.MethodPost), RequireScopes("orders:write"))
+	a.describeRoute(a.Router.Handle("/env", a.InternalAccess(ok)), internalAccessPolicy)
+
+	want := []RoutePolicy{
+		{Router: "public", Path: "/env", Policies: []string{internalAccessPolicy}},
+		{Router: "public", Path: "/health", Policies: []string{}},
+		{Router: "public", Name: "login", Path: "/login", Policies: []string{"jwt"}},
+		{Router: "public", Path: "/orders", Methods: []string{http.MethodGet}, Policies: []string{"api_key|jwt"}},
+		{Router: "public", Path: "/orders", Methods: []string{http.MethodPost}, Policies: []string{"api_key|jwt", "scopes(orders:write)"}},
+		{Router: "public", Path: "/public/docs", Policies: []string{"api_key"}},
+	}
+	if list := a.RoutePolicies(); !reflect.DeepEqual(list, want) {
+		t.Errorf("got %+v\nwant %+v", list, want)
+	}
+}
@@ -0,0 +1,206 @@
+package go_base_api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	RateLimitKeyIP      = "ip"
+	RateLimitKeyHeader  = "header"
+	RateLimitKeySubject = "subject"
+
+	RateLimitStoreLocal  = "local"
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// RateLimitRule allows Requests per Period seconds. The local token bucket
+// store allows bursts of up to Burst requests (Requests when 0), the sliding
+// window stores ignore Burst. Requests 0 disables the limit.
+type RateLimitRule struct {
+	Requests int `json:"requests" yaml:"requests"`
+	Period   int `json:"period" yaml:"period"`
+	Burst    int `json:"burst" yaml:"burst"`
+}
+
+// RateLimitConfig limits requests per client on API.Router. The client key is
+// the client IP, the Header value or the authenticated subject (see
+// WithSubject), falling back to the IP. Routes overrides the global rule by
+// path prefix or route name, Ignore lists routes that are never limited.
+// With Key header or subject the IP rule, when set, also limits clients by
+// IP before they are authenticated, so failed attempts and rotated header
+// values count. Store selects where counters live (see RateLimitStore), FailClosed rejects
+// requests with 503 instead of letting them through when the store fails.
+type RateLimitConfig struct {
+	RateLimitRule `yaml:",inline"`
+	Enabled       bool                     `json:"enabled" yaml:"enabled"`
+	Key           string                   `json:"key" yaml:"key"`
+	Header        string                   `json:"header" yaml:"header"`
+	IP            RateLimitRule            `json:"ip" yaml:"ip"`
+	Routes        map[string]RateLimitRule `json:"routes" yaml:"routes"`
+	Ignore        []string                 `json:"ignore" yaml:"ignore"`
+	Store         string                   `json:"store" yaml:"store"`
+	Prefix        string                   `json:"prefix" yaml:"prefix"`
+	FailClosed    bool                     `json:"fail_closed" yaml:"fail_closed"`
+	Redis         RedisConfig              `json:"redis" yaml:"redis"`
+}
+
+type ctxKeySubject struct{}
+
+// WithSubject stores the authenticated subject used as rate limit key.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, ctxKeySubject{}, subject)
+}
+
+// SubjectFrom returns the subject stored by WithSubject, or "".
+func SubjectFrom(ctx context.Context) string {
+	s, _ := ctx.Value(ctxKeySubject{}).(string)
+	return s
+}
+
+func (r RateLimitRule) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Requests
+}
+
+func (r RateLimitRule) period() time.Duration {
+	if r.Period > 0 {
+		return time.Duration(r.Period) * time.Second
+	}
+	return time.Second
+}
+
+// rateLimitRule returns the rule name and rule for the request.
+func (a *API) rateLimitRule(req *http.Request) (string, RateLimitRule) {
+	conf := a.Config.RateLimit
+	name := ""
+	if route := mux.CurrentRoute(req); route != nil {
+		name = route.GetName()
+	}
+	if _, ignored := matchRoute(conf.Ignore, req.URL.Path, name); ignored {
+		return "", RateLimitRule{}
+	}
+	if len(conf.Routes) > 0 {
+		rules := make([]string, 0, len(conf.Routes))
+		for r := range conf.Routes {
+			rules = append(rules, r)
+		}
+		// longest first, so /api/v1/orders wins over /api
+		sort.Slice(rules, func(i, j int) bool { return len(rules[i]) > len(rules[j]) })
+		if rule, ok := matchRoute(rules, req.URL.Path, name); ok {
+			return rule, conf.Routes[rule]
+		}
+	}
+	return "", conf.RateLimitRule
+}
+
+// ipRateLimitRule returns the rule of IPRateLimit for the request, none
+// unless RateLimit.IP is set.
+func (a *API) ipRateLimitRule(req *http.Request) (string, RateLimitRule) {
+	conf := a.Config.RateLimit
+	name := ""
+	if route := mux.CurrentRoute(req); route != nil {
+		name = route.GetName()
+	}
+	if _, ignored := matchRoute(conf.Ignore, req.URL.Path, name); ignored {
+		return "", RateLimitRule{}
+	}
+	return "ip", conf.IP
+}
+
+// rateLimitKey returns the client key configured by RateLimit.Key. Header
+// values are hashed, they are often credentials and end up in store keys.
+func (a *API) rateLimitKey(req *http.Request) string {
+	switch a.Config.RateLimit.Key {
+	case RateLimitKeyHeader:
+		if v := req.Header.Get(a.Config.RateLimit.Header); v != "" {
+			sum := sha256.Sum256([]byte(v))
+			return "header:" + hex.EncodeToString(sum[:])
+		}
+	case RateLimitKeySubject:
+		if s := SubjectFrom(req.Context()); s != "" {
+			return "subject:" + s
+		}
+	}
+	return "ip:" + a.ClientIP(req)
+}
+
+func (a *API) newRateLimitedCounter() *prometheus.CounterVec {
+	return a.registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: a.metricsNamespace(), Subsystem: "http", Name: "rate_limited_total",
+		Help: "The total number of requests rejected by the rate limiter.",
+	}, []string{"route"})).(*prometheus.CounterVec)
+}
+
+// RateLimit rejects clients over their RateLimit rule with 429 and sets the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers (plus
+// Retry-After when rejected).
+func (a *API) RateLimit(next http.Handler) http.Handler {
+	return a.rateLimit(next, a.rateLimitRule, a.rateLimitKey)
+}
+
+// IPRateLimit is RateLimit keyed by client IP with the RateLimit.IP rule.
+// Initialize mounts it before the authenticators when RateLimit.Key is
+// header or subject, so unauthenticated clients are limited too.
+func (a *API) IPRateLimit(next http.Handler) http.Handler {
+	return a.rateLimit(next, a.ipRateLimitRule, func(req *http.Request) string {
+		return "ip:" + a.ClientIP(req)
+	})
+}
+
+func (a *API) rateLimit(next http.Handler, ruleFor func(*http.Request) (string, RateLimitRule), keyFor func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name, rule := ruleFor(req)
+		if rule.Requests <= 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+		res, err := a.rateLimitStore().Allow(req.Context(),
+			a.Config.RateLimit.Prefix+a.Config.App+":"+name+"|"+keyFor(req), rule)
+		if err != nil {
+			LoggerFrom(req.Context()).Error("rate limit store: ", err)
+			if a.Config.RateLimit.FailClosed {
+				a.Error(w, req, &APIError{Status: http.StatusServiceUnavailable, Detail: "rate limiter unavailable"})
+				return
+			}
+			next.ServeHTTP(w, req)
+			return
+		}
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			if a.rateLimited != nil {
+				route := routeTemplate(req)
+				if route == "" {
+					route = UnmatchedRoute
+				}
+				a.rateLimited.WithLabelValues(route).Inc()
+			}
+			a.Error(w, req, &APIError{Status: http.StatusTooManyRequests,
+				Detail: fmt.Sprintf("rate limit of %d requests per %s exceeded", rule.Requests, rule.period()),
+				Err:    ErrTooManyRequests})
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
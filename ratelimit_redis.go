@@ -0,0 +1,268 @@
+package go_base_api
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisConfig is the Redis server used by the redis rate limit store.
+// Timeout (seconds) bounds each round trip.
+type RedisConfig struct {
+	Address  string `json:"address" yaml:"address"`
+	Password string `json:"-" yaml:"password"`
+	DB       int    `json:"db" yaml:"db"`
+	Timeout  int    `json:"timeout" yaml:"timeout"`
+	PoolSize int    `json:"pool_size" yaml:"pool_size"`
+}
+
+// RedisRateLimitStore is a sliding window RateLimitStore kept in Redis, so
+// all replicas share the limits. It speaks RESP directly, checks and counts
+// in one Lua script on the Redis clock and keeps a small pool of connections.
+type RedisRateLimitStore struct {
+	conf RedisConfig
+	pool chan *redisConn
+}
+
+func NewRedisRateLimitStore(conf RedisConfig) *RedisRateLimitStore {
+	if conf.Address == "" {
+		conf.Address = "localhost:6379"
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 1
+	}
+	if conf.PoolSize <= 0 {
+		conf.PoolSize = 10
+	}
+	return &RedisRateLimitStore{conf: conf, pool: make(chan *redisConn, conf.PoolSize)}
+}
+
+// slidingWindowScript checks and counts a request atomically. The window
+// position comes from the Redis clock, so replicas with skewed clocks agree.
+// KEYS[1] is the hash-tagged key prefix of the window counters (all in one
+// cluster slot), ARGV the limit and the window (ms). It returns {allowed,
+// cur, prev, elapsed} with the counts before this request.
+var slidingWindowScript = redisScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local limit, window = tonumber(ARGV[1]), tonumber(ARGV[2])
+local idx = math.floor(now / window)
+local elapsed = now - idx * window
+local curKey = KEYS[1] .. ':' .. string.format('%d', idx)
+local prevKey = KEYS[1] .. ':' .. string.format('%d', idx - 1)
+local cur = tonumber(redis.call('GET', curKey) or '0')
+local prev = tonumber(redis.call('GET', prevKey) or '0')
+if prev * (1 - elapsed / window) + cur + 1 <= limit then
+	redis.call('INCR', curKey)
+	redis.call('PEXPIRE', curKey, 2 * window)
+	return {1, cur, prev, elapsed}
+end
+return {0, cur, prev, elapsed}
+`)
+
+type redisScript string
+
+// sha1 returns the SHA-1 hex digest used by EVALSHA.
+func (s redisScript) sha1() string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// eval runs the script with EVALSHA, loading it with EVAL when the server does not know it.
+func (c *redisConn) eval(script redisScript, keys []string, args ...string) (interface{}, error) {
+	cmd := append([]string{"EVALSHA", script.sha1(), strconv.Itoa(len(keys))}, keys...)
+	cmd = append(cmd, args...)
+	replies, err := c.do(cmd)
+	var rerr redisError
+	if errors.As(err, &rerr) && strings.HasPrefix(string(rerr), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", string(script)
+		replies, err = c.do(cmd)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// Allow checks and counts a request for key in one script, so concurrent
+// requests of all replicas see each other.
+func (s *RedisRateLimitStore) Allow(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	reply, err := conn.eval(slidingWindowScript, []string{redisKey(key)},
+		strconv.Itoa(rule.Requests), strconv.FormatInt(rule.period().Milliseconds(), 10))
+	if err != nil {
+		conn.Close()
+		return RateLimitResult{}, err
+	}
+	s.put(conn)
+	counts, ok := reply.([]interface{})
+	if !ok || len(counts) != 4 {
+		return RateLimitResult{}, fmt.Errorf("redis: unexpected script reply %v", reply)
+	}
+	var n [4]int64
+	for i, c := range counts {
+		if n[i], ok = c.(int64); !ok {
+			return RateLimitResult{}, fmt.Errorf("redis: unexpected script reply %v", reply)
+		}
+	}
+	res := slidingWindowResult(n[2], n[1], rule, time.Duration(n[3])*time.Millisecond)
+	res.Allowed = n[0] == 1
+	return res, nil
+}
+
+// redisKey wraps key in a hash tag, so its window counters stay in one
+// Redis Cluster slot.
+func redisKey(key string) string {
+	return "{" + key + "}"
+}
+
+// Close closes the pooled connections.
+func (s *RedisRateLimitStore) Close(context.Context) error {
+	for {
+		select {
+		case c := <-s.pool:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (s *RedisRateLimitStore) get(ctx context.Context) (*redisConn, error) {
+	deadline := time.Now().Add(time.Duration(s.conf.Timeout) * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	select {
+	case c := <-s.pool:
+		if err := c.SetDeadline(deadline); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	default:
+	}
+	d := net.Dialer{Deadline: deadline}
+	nc, err := d.DialContext(ctx, "tcp", s.conf.Address)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if err := c.SetDeadline(deadline); err != nil {
+		c.Close()
+		return nil, err
+	}
+	var setup [][]string
+	if s.conf.Password != "" {
+		setup = append(setup, []string{"AUTH", s.conf.Password})
+	}
+	if s.conf.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.conf.DB)})
+	}
+	if len(setup) > 0 {
+		if _, err := c.do(setup...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *RedisRateLimitStore) put(c *redisConn) {
+	select {
+	case s.pool <- c:
+	default:
+		c.Close()
+	}
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// do sends the commands in one pipeline and reads a reply for each.
+func (c *redisConn) do(cmds ...[]string) ([]interface{}, error) {
+	for _, cmd := range cmds {
+		fmt.Fprintf(c.w, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		reply, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if rerr, ok := reply.(redisError); ok {
+			return nil, fmt.Errorf("redis %s: %w", cmds[i][0], rerr)
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// read parses one RESP reply: string, error, integer, bulk string (nil when
+// missing) or array.
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+}
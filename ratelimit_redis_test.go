@@ -0,0 +1,214 @@
+package go_base_api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testRedisEpoch is a window boundary, the in-process Redis clock starts
+// there and moves only with SetTime.
+var testRedisEpoch = time.Unix(1700000000, 0)
+
+func newTestRedisStore(t *testing.T) (*RedisRateLimitStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	mr.SetTime(testRedisEpoch)
+	s := NewRedisRateLimitStore(RedisConfig{Address: mr.Addr()})
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s, mr
+}
+
+func TestRedisRateLimitStoreAllow(t *testing.T) {
+	s, mr := newTestRedisStore(t)
+	rule := RateLimitRule{Requests: 3, Period: 10}
+	for i := 0; i < 3; i++ {
+		res, err := s.Allow(context.Background(), "k", rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 2-i || res.Limit != 3 {
+			t.Fatalf("request %d: got %+v", i, res)
+		}
+	}
+	res, err := s.Allow(context.Background(), "k", rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 10*time.Second || res.Reset != 10*time.Second {
+		t.Fatalf("request over the limit: got %+v", res)
+	}
+	// rejected requests are not counted
+	idx, _ := windowPosition(testRedisEpoch, rule.period())
+	key := "{k}:" + strconv.FormatInt(idx, 10)
+	if v, _ := mr.Get(key); v != "3" {
+		t.Errorf("counter = %q, want 3", v)
+	}
+	if ttl := mr.TTL(key); ttl <= 0 || ttl > 20*time.Second {
+		t.Errorf("ttl = %v, want at most two windows", ttl)
+	}
+	if res, _ := s.Allow(context.Background(), "other", rule); !res.Allowed {
+		t.Errorf("other key: got %+v", res)
+	}
+}
+
+func TestRedisRateLimitStoreRollover(t *testing.T) {
+	s, mr := newTestRedisStore(t)
+	rule := RateLimitRule{Requests: 4, Period: 1}
+	for i := 0; i < 4; i++ {
+		if res, err := s.Allow(context.Background(), "k", rule); err != nil || !res.Allowed {
+			t.Fatalf("request %d: %+v %v", i, res, err)
+		}
+	}
+	// half of the previous window still counts: 4*0.5 + 1 + 1 fits, one more does not
+	mr.SetTime(testRedisEpoch.Add(1500 * time.Millisecond))
+	for i, want := range []bool{true, true, false} {
+		res, err := s.Allow(context.Background(), "k", rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != want || res.Reset != 500*time.Millisecond {
+			t.Fatalf("request %d after rollover: got %+v, want allowed=%v", i, res, want)
+		}
+	}
+	// two windows later nothing is left
+	mr.SetTime(testRedisEpoch.Add(3500 * time.Millisecond))
+	res, err := s.Allow(context.Background(), "k", rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 3 {
+		t.Fatalf("fresh window: got %+v", res)
+	}
+}
+
+func TestRedisRateLimitStoreReloadsScript(t *testing.T) {
+	s, _ := newTestRedisStore(t)
+	rule := RateLimitRule{Requests: 2, Period: 10}
+	if _, err := s.Allow(context.Background(), "k", rule); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := s.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.do([]string{"SCRIPT", "FLUSH"}); err != nil {
+		t.Fatal(err)
+	}
+	s.put(conn)
+	res, err := s.Allow(context.Background(), "k", rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("got %+v", res)
+	}
+}
+
+func TestRedisConnNilReplies(t *testing.T) {
+	s, _ := newTestRedisStore(t)
+	conn, err := s.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	replies, err := conn.do([]string{"SET", "a", "1"}, []string{"GET", "missing"}, []string{"INCR", "a"}, []string{"GET", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"OK", nil, int64(2), []byte("2")}
+	if !reflect.DeepEqual(replies, want) {
+		t.Fatalf("got %#v, want %#v", replies, want)
+	}
+	if _, err := conn.do([]string{"INCR"}); err == nil || !strings.Contains(err.Error(), "redis INCR: ERR") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestRedisConnRead(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want interface{}
+	}{
+		{"+OK\r\n", "OK"},
+		{"-ERR boom\r\n", redisError("ERR boom")},
+		{":42\r\n", int64(42)},
+		{"$-1\r\n", nil},
+		{"$0\r\n\r\n", []byte{}},
+		{"$5\r\nhe\r\no\r\n", []byte("he\r\no")},
+		{"*-1\r\n", nil},
+		{"*3\r\n:1\r\n$-1\r\n*1\r\n+x\r\n", []interface{}{int64(1), nil, []interface{}{"x"}}},
+	}
+	for _, tt := range tests {
+		c := &redisConn{r: bufio.NewReader(strings.NewReader(tt.raw))}
+		got, err := c.read()
+		if err != nil {
+			t.Errorf("%q: %v", tt.raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v, want %#v", tt.raw, got, tt.want)
+		}
+	}
+	for _, raw := range []string{"", "OK\r\n", "+OK\n", "?1\r\n", "$3\r\nab"} {
+		c := &redisConn{r: bufio.NewReader(strings.NewReader(raw))}
+		if got, err := c.read(); err == nil {
+			t.Errorf("%q: got %#v, want error", raw, got)
+		}
+	}
+}
+
+func TestRateLimitRedisUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+	for _, tt := range []struct {
+		failClosed bool
+		status     int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusServiceUnavailable},
+	} {
+		a := &API{RateLimitStore: NewRedisRateLimitStore(RedisConfig{Address: addr})}
+		a.Config.App = "test"
+		a.Config.RateLimit = RateLimitConfig{Enabled: true, RateLimitRule: RateLimitRule{Requests: 1}, FailClosed: tt.failClosed}
+		h := a.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		if rec.Code != tt.status {
+			t.Errorf("fail_closed=%v: status %d, want %d", tt.failClosed, rec.Code, tt.status)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("fail_closed=%v: unexpected RateLimit headers", tt.failClosed)
+		}
+	}
+}
+
+func TestRateLimitRedisShared(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replicas := make([]http.Handler, 2)
+	for i := range replicas {
+		a := &API{RateLimitStore: NewRedisRateLimitStore(RedisConfig{Address: mr.Addr()})}
+		a.Config.App = "test"
+		a.Config.RateLimit = RateLimitConfig{Enabled: true, RateLimitRule: RateLimitRule{Requests: 3, Period: 60}}
+		replicas[i] = a.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	}
+	for i, want := range []int{200, 200, 200, 429} {
+		rec := httptest.NewRecorder()
+		replicas[i%2].ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		if rec.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, rec.Code, want)
+		}
+		if i == 3 && rec.Header().Get("Retry-After") == "" {
+			t.Error("429 without Retry-After")
+		}
+	}
+}
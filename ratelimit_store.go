@@ -0,0 +1,191 @@
+package go_base_api
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitResult is the outcome of one rate limit check. Reset is the time
+// until the quota is restored, RetryAfter until a rejected client may retry.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts requests per key. Allow records a request for key
+// if rule permits it. Stores shared by replicas (Redis) make the limits
+// hold for the whole service.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error)
+}
+
+// rateLimitStore returns API.RateLimitStore or the local token bucket store.
+func (a *API) rateLimitStore() RateLimitStore {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.RateLimitStore == nil {
+		a.RateLimitStore = newTokenBuckets()
+	}
+	return a.RateLimitStore
+}
+
+// InitializeRateLimitStore creates the store selected by RateLimit.Store
+// unless API.RateLimitStore is already set.
+func (a *API) InitializeRateLimitStore() {
+	if a.RateLimitStore != nil {
+		return
+	}
+	switch a.Config.RateLimit.Store {
+	case "", RateLimitStoreLocal:
+		a.RateLimitStore = newTokenBuckets()
+	case RateLimitStoreMemory:
+		a.RateLimitStore = NewMemoryRateLimitStore()
+	case RateLimitStoreRedis:
+		store := NewRedisRateLimitStore(a.Config.RateLimit.Redis)
+		a.RateLimitStore = store
+		a.RegisterShutdown("rate limit store", 0, store.Close)
+	default:
+		Log.Errorf("Unknown rate limit store %q, using local", a.Config.RateLimit.Store)
+		a.RateLimitStore = newTokenBuckets()
+	}
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket is refilled
+}
+
+// tokenBuckets keeps one token bucket per key in process memory.
+type tokenBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweep   time.Time
+	now     func() time.Time
+}
+
+func newTokenBuckets() *tokenBuckets {
+	return &tokenBuckets{buckets: map[string]*tokenBucket{}, now: time.Now}
+}
+
+// Allow removes a token from the bucket of key.
+func (tb *tokenBuckets) Allow(_ context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	now := tb.now()
+	capacity := float64(rule.burst())
+	perToken := float64(rule.period()) / float64(rule.Requests)
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if now.Sub(tb.sweep) > time.Minute {
+		for k, b := range tb.buckets {
+			// a refilled bucket is the same as a new one
+			if !now.Before(b.full) {
+				delete(tb.buckets, k)
+			}
+		}
+		tb.sweep = now
+	}
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		tb.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last))/perToken)
+	b.last = now
+	res := RateLimitResult{Allowed: b.tokens >= 1, Limit: rule.burst()}
+	if res.Allowed {
+		b.tokens--
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) * perToken)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((capacity - b.tokens) * perToken)
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+// windowPosition returns the index of the fixed window containing now and
+// the time elapsed in it.
+func windowPosition(now time.Time, window time.Duration) (int64, time.Duration) {
+	idx := now.UnixNano() / int64(window)
+	return idx, time.Duration(now.UnixNano() - idx*int64(window))
+}
+
+// slidingWindowResult estimates the requests in the last window from the
+// previous and current fixed windows (weighted by overlap) and decides
+// whether one more request fits. cur excludes the request being checked.
+func slidingWindowResult(prev, cur int64, rule RateLimitRule, elapsed time.Duration) RateLimitResult {
+	window := rule.period()
+	limit := float64(rule.Requests)
+	estimate := float64(prev)*(1-float64(elapsed)/float64(window)) + float64(cur)
+	res := RateLimitResult{Allowed: estimate+1 <= limit, Limit: rule.Requests, Reset: window - elapsed}
+	if res.Allowed {
+		estimate++
+	} else if prev > 0 && float64(cur)+1 <= limit {
+		// wait until enough of the previous window has slid out
+		res.RetryAfter = time.Duration((estimate + 1 - limit) / float64(prev) * float64(window))
+	} else {
+		res.RetryAfter = window - elapsed
+	}
+	res.Remaining = int(math.Max(0, math.Floor(limit-estimate)))
+	return res
+}
+
+type slidingWindow struct {
+	window    time.Duration
+	index     int64
+	prev, cur int64
+}
+
+// MemoryRateLimitStore is a sliding window RateLimitStore in process memory,
+// limits are per replica.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	windows map[string]*slidingWindow
+	sweep   time.Time
+	now     func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{windows: map[string]*slidingWindow{}, now: time.Now}
+}
+
+// Allow counts a request for key in the sliding window of rule.Period.
+func (s *MemoryRateLimitStore) Allow(_ context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	now := s.now()
+	idx, elapsed := windowPosition(now, rule.period())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.sweep) > time.Minute {
+		for k, w := range s.windows {
+			if cur, _ := windowPosition(now, w.window); w.index < cur-1 {
+				delete(s.windows, k)
+			}
+		}
+		s.sweep = now
+	}
+	w, ok := s.windows[key]
+	if !ok {
+		w = &slidingWindow{window: rule.period(), index: idx}
+		s.windows[key] = w
+	}
+	switch w.index {
+	case idx:
+	case idx - 1:
+		w.prev, w.cur = w.cur, 0
+	default:
+		w.prev, w.cur = 0, 0
+	}
+	w.index = idx
+	res := slidingWindowResult(w.prev, w.cur, rule, elapsed)
+	if res.Allowed {
+		w.cur++
+	}
+	return res, nil
+}
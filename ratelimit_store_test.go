@@ -0,0 +1,81 @@
+package go_base_api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBuckets(t *testing.T) {
+	type step struct {
+		after     time.Duration // clock advance before the request
+		key       string
+		allowed   bool
+		remaining int
+	}
+	tests := []struct {
+		name  string
+		rule  RateLimitRule
+		steps []step
+	}{
+		{"requests per second", RateLimitRule{Requests: 2, Period: 1}, []step{
+			{0, "a", true, 1},
+			{0, "a", true, 0},
+			{0, "a", false, 0},
+			{0, "b", true, 1},
+			{500 * time.Millisecond, "a", true, 0},
+			{0, "a", false, 0},
+			{5 * time.Second, "a", true, 1},
+		}},
+		{"burst", RateLimitRule{Requests: 1, Period: 10, Burst: 3}, []step{
+			{0, "a", true, 2},
+			{0, "a", true, 1},
+			{0, "a", true, 0},
+			{0, "a", false, 0},
+			{10 * time.Second, "a", true, 0},
+		}},
+		// the sweep must not forget buckets that are still being refilled
+		{"long period", RateLimitRule{Requests: 2, Period: 3600}, []step{
+			{0, "a", true, 1},
+			{0, "a", true, 0},
+			{11 * time.Minute, "b", true, 1},
+			{0, "a", false, 0},
+			{19 * time.Minute, "a", true, 0},
+			{0, "a", false, 0},
+		}},
+	}
+	for _, tt := range tests {
+		tb := newTokenBuckets()
+		now := time.Unix(1700000000, 0)
+		tb.now = func() time.Time { return now }
+		for i, s := range tt.steps {
+			now = now.Add(s.after)
+			res, err := tb.Allow(context.Background(), s.key, tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Allowed != s.allowed || res.Remaining != s.remaining {
+				t.Errorf("%s: step %d: got %+v, want allowed=%v remaining=%d", tt.name, i, res, s.allowed, s.remaining)
+			}
+			if !res.Allowed && res.RetryAfter <= 0 {
+				t.Errorf("%s: step %d: rejected without RetryAfter", tt.name, i)
+			}
+		}
+	}
+}
+
+func TestTokenBucketsSweep(t *testing.T) {
+	tb := newTokenBuckets()
+	now := time.Unix(1700000000, 0)
+	tb.now = func() time.Time { return now }
+	tb.Allow(context.Background(), "short", RateLimitRule{Requests: 10, Period: 1})
+	tb.Allow(context.Background(), "long", RateLimitRule{Requests: 1, Period: 3600})
+	now = now.Add(2 * time.Minute)
+	tb.Allow(context.Background(), "other", RateLimitRule{Requests: 10, Period: 1})
+	if _, ok := tb.buckets["short"]; ok {
+		t.Error("refilled bucket kept")
+	}
+	if _, ok := tb.buckets["long"]; !ok {
+		t.Error("bucket still refilling was swept")
+	}
+}
@@ -0,0 +1,104 @@
+package go_base_api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// keyRecorder is a RateLimitStore remembering the keys it was asked for.
+type keyRecorder struct {
+	RateLimitStore
+	keys []string
+}
+
+func (k *keyRecorder) Allow(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	k.keys = append(k.keys, key)
+	return k.RateLimitStore.Allow(ctx, key, rule)
+}
+
+func TestRateLimitIPBeforeAuth(t *testing.T) {
+	token := func(sub string) string {
+		c := validClaims()
+		c["sub"] = sub
+		return "Bearer " + signToken(t, map[string]interface{}{"alg": "HS256"}, c, []byte("secret"))
+	}
+	type req struct {
+		auth   string
+		status int
+	}
+	tests := []struct {
+		name string
+		ip   RateLimitRule
+		reqs []req
+	}{
+		{"ip rule", RateLimitRule{Requests: 3, Period: 60}, []req{
+			{"Bearer bad", 401},
+			{token("alice"), 200},
+			{token("alice"), 429}, // subject limit
+			{"Bearer bad", 429},   // IP limit, before the token is checked
+		}},
+		// without an ip rule callers behind one address do not share a quota
+		{"no ip rule", RateLimitRule{}, []req{
+			{token("alice"), 200},
+			{token("bob"), 200},
+			{token("carol"), 200},
+			{token("alice"), 429},
+			{"Bearer bad", 401},
+		}},
+	}
+	for _, tt := range tests {
+		a := &API{RateLimitStore: NewMemoryRateLimitStore()}
+		a.Config.App = "test"
+		a.Config.JWT = JWTConfig{Enabled: true, Secret: "secret"}
+		a.Config.RateLimit = RateLimitConfig{Enabled: true, Key: RateLimitKeySubject,
+			RateLimitRule: RateLimitRule{Requests: 1, Period: 60}, IP: tt.ip}
+		r := mux.NewRouter()
+		r.Use(a.IPRateLimit, a.JWTAuth, a.RateLimit)
+		r.Handle("/orders", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		for i, rq := range tt.reqs {
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.Header.Set("Authorization", rq.auth)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != rq.status {
+				t.Errorf("%s: request %d: status %d, want %d", tt.name, i, rec.Code, rq.status)
+			}
+		}
+	}
+}
+
+func TestRateLimitHeaderKey(t *testing.T) {
+	store := &keyRecorder{RateLimitStore: NewMemoryRateLimitStore()}
+	a := &API{RateLimitStore: store}
+	a.Config.App = "test"
+	a.Config.RateLimit = RateLimitConfig{Enabled: true, Key: RateLimitKeyHeader, Header: "X-API-Key",
+		RateLimitRule: RateLimitRule{Requests: 1, Period: 60}, IP: RateLimitRule{Requests: 3, Period: 60}}
+	h := a.IPRateLimit(a.RateLimit(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	for i, tt := range []struct {
+		key    string
+		status int
+	}{
+		{"billing.s3cret", 200},
+		{"billing.s3cret", 429},
+		{"rotated-1", 200},
+		{"rotated-2", 429}, // IP limit
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("X-API-Key", tt.key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("request %d: status %d, want %d", i, rec.Code, tt.status)
+		}
+	}
+	for _, k := range store.keys {
+		if strings.Contains(k, "s3cret") || strings.Contains(k, "rotated") {
+			t.Errorf("store key %q contains the header value", k)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package go_base_api
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func newPanicsCounter(register func(prometheus.Collector) prometheus.Collector) *prometheus.CounterVec {
+	return register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "panics_total",
+		Help: "Number of panics recovered in HTTP handlers.",
+	}, []string{"route"})).(*prometheus.CounterVec)
+}
+
+// routeTemplate returns the path template of the matched mux route, or "".
+func routeTemplate(req *http.Request) string {
+	if route := mux.CurrentRoute(req); route != nil {
+		tpl, _ := route.GetPathTemplate()
+		return tpl
+	}
+	return ""
+}
+
+// PanicRecovery recovers handler panics: the stack is logged with the request
+// ID and route, the panic is recorded on the span and counted in panics_total,
+// and a 500 is written through the error renderer unless the response has
+// already started. http.ErrAbortHandler is re-panicked so net/http aborts the
+// connection silently.
+func (a *API) PanicRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec, ww := recordResponse(w)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			route := routeTemplate(req)
+			err := fmt.Errorf("panic: %v", p)
+			LoggerFrom(req.Context()).WithFields(logrus.Fields{
+				"route": route,
+				"stack": string(debug.Stack()),
+			}).Errorf("%s %s: %v", req.Method, req.URL.Path, err)
+
+			span := oteltrace.SpanFromContext(req.Context())
+			span.RecordError(err, oteltrace.WithStackTrace(true))
+			span.SetStatus(codes.Error, "panic")
+			if a.panics != nil {
+				a.panics.WithLabelValues(route).Inc()
+			}
+			if rec.wroteHeader {
+				return
+			}
+			a.writeError(ww, req, newProblem(req, &APIError{Status: http.StatusInternalServerError, Err: err}))
+		}()
+		next.ServeHTTP(ww, req)
+	})
+}
@@ -0,0 +1,187 @@
+package go_base_api
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const RedactedValue = "******"
+
+// DefaultRedactPatterns are the key fragments masked by Redact when RedactPatterns is not set.
+var DefaultRedactPatterns = []string{"password", "passwd", "secret", "token", "key", "credential", "dsn"}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Redact returns a copy of v as maps and slices (keyed by json names) where
+// the scalar values of keys containing one of patterns (case-insensitive) and
+// of fields tagged `redact:"true"` are replaced by RedactedValue. Everything
+// nested under a matching key is masked too, so maps like Secrets keep their
+// keys but not their values.
+func Redact(v interface{}, patterns []string) interface{} {
+	if patterns == nil {
+		patterns = DefaultRedactPatterns
+	}
+	lower := make([]string, len(patterns))
+	for i, p := range patterns {
+		lower[i] = strings.ToLower(p)
+	}
+	return redactValue(reflect.ValueOf(v), false, lower)
+}
+
+// Redact masks v with the configured RedactPatterns.
+func (a *API) Redact(v interface{}) interface{} {
+	return Redact(v, a.Config.RedactPatterns)
+}
+
+// PrintConfigToLog logs the redacted config as JSON.
+func PrintConfigToLog(conf interface{}, patterns ...string) {
+	if len(patterns) == 0 {
+		patterns = nil
+	}
+	raw, err := json.Marshal(Redact(conf, patterns))
+	if err != nil {
+		Log.Error(err)
+		return
+	}
+	Log.Info(string(raw))
+}
+
+// PrintConfigToLog logs the redacted AppConfig.
+func (a *API) PrintConfigToLog() {
+	PrintConfigToLog(a.Config.AppConfig, a.Config.RedactPatterns...)
+}
+
+func sensitiveKey(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	for _, p := range patterns {
+		if p != "" && strings.Contains(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLeafType(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PtrTo(t).Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+func redactValue(v reflect.Value, sensitive bool, patterns []string) interface{} {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if isLeafType(v.Type()) {
+		if sensitive {
+			return RedactedValue
+		}
+		// a marshaler can produce keys of its own (json.RawMessage), so
+		// objects and arrays are redacted in their JSON form
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		g, err := toGeneric(p.Interface())
+		if err != nil {
+			return nil
+		}
+		switch g.(type) {
+		case map[string]interface{}, []interface{}:
+			return redactValue(reflect.ValueOf(g), false, patterns)
+		}
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		out := map[string]interface{}{}
+		redactStruct(v, sensitive, patterns, out)
+		return out
+	case reflect.Map:
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k := iter.Key()
+			for k.Kind() == reflect.Interface {
+				k = k.Elem()
+			}
+			key := ""
+			if k.Kind() == reflect.String {
+				key = k.String()
+			} else {
+				raw, _ := json.Marshal(k.Interface())
+				key = strings.Trim(string(raw), `"`)
+			}
+			out[key] = redactValue(iter.Value(), sensitive || sensitiveKey(key, patterns), patterns)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if sensitive {
+				return RedactedValue
+			}
+			return v.Interface()
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), sensitive, patterns)
+		}
+		return out
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return nil
+	}
+	if sensitive {
+		return RedactedValue
+	}
+	return v.Interface()
+}
+
+func redactStruct(v reflect.Value, sensitive bool, patterns []string, out map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		fv := v.Field(i)
+		fieldSensitive := sensitive || f.Tag.Get("redact") == "true"
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv, ft = fv.Elem(), ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isLeafType(ft) {
+				redactStruct(fv, fieldSensitive, patterns, out)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+		out[name] = redactValue(fv, fieldSensitive || sensitiveKey(name, patterns), patterns)
+	}
+}
@@ -0,0 +1,143 @@
+package go_base_api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type redactDB struct {
+	Host     string `json:"host"`
+	Password string `json:"password"`
+	DSN      string `json:"dsn,omitempty"`
+}
+
+type redactEmbedded struct {
+	APIToken string `json:"api_token"`
+	Region   string `json:"region"`
+}
+
+type redactConfig struct {
+	redactEmbedded
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Pass     string `json:"pass" redact:"true"`
+	Hidden   string `json:"-"`
+	internal string
+	DB       *redactDB         `json:"db"`
+	Replica  *redactDB         `json:"replica"`
+	Secrets  map[string]string `json:"secrets"`
+	Labels   map[string]string `json:"labels"`
+	Keys     []string          `json:"keys"`
+	Hosts    []string          `json:"hosts"`
+	Cert     []byte            `json:"cert_secret"`
+	Started  time.Time         `json:"started"`
+	Extra    interface{}       `json:"extra"`
+	Untagged string
+}
+
+func TestRedact(t *testing.T) {
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	conf := redactConfig{
+		redactEmbedded: redactEmbedded{APIToken: "tok", Region: "eu"},
+		Name:           "orders",
+		Port:           8080,
+		Pass:           "hunter2",
+		Hidden:         "hidden",
+		internal:       "internal",
+		DB:             &redactDB{Host: "db", Password: "pw"},
+		Secrets:        map[string]string{"stripe": "sk_live", "github": "ghp"},
+		Labels:         map[string]string{"team": "core", "signing_key": "k"},
+		Keys:           []string{"a", "b"},
+		Hosts:          []string{"h1"},
+		Cert:           []byte("pem"),
+		Started:        started,
+		Extra:          map[string]interface{}{"nested": map[string]interface{}{"Token": 42, "ok": true}},
+		Untagged:       "visible",
+	}
+	want := map[string]interface{}{
+		"api_token":   RedactedValue,
+		"region":      "eu",
+		"name":        "orders",
+		"port":        8080,
+		"pass":        RedactedValue,
+		"db":          map[string]interface{}{"host": "db", "password": RedactedValue},
+		"replica":     nil,
+		"secrets":     map[string]interface{}{"stripe": RedactedValue, "github": RedactedValue},
+		"labels":      map[string]interface{}{"team": "core", "signing_key": RedactedValue},
+		"keys":        []interface{}{RedactedValue, RedactedValue},
+		"hosts":       []interface{}{"h1"},
+		"cert_secret": RedactedValue,
+		"started":     started,
+		"extra":       map[string]interface{}{"nested": map[string]interface{}{"Token": RedactedValue, "ok": true}},
+		"Untagged":    "visible",
+	}
+	got := Redact(conf, nil)
+	if !reflect.DeepEqual(got, want) {
+		g, _ := json.MarshalIndent(got, "", "  ")
+		t.Fatalf("got %s", g)
+	}
+	if conf.DB.Password != "pw" || conf.Secrets["stripe"] != "sk_live" {
+		t.Error("Redact changed its input")
+	}
+	if got := Redact(&conf, nil); !reflect.DeepEqual(got, want) {
+		t.Error("pointer redacted differently")
+	}
+}
+
+func TestRedactPatterns(t *testing.T) {
+	v := map[string]interface{}{"Password": "pw", "iban": "DE00", "user": map[int]string{1: "x"}}
+	want := map[string]interface{}{"Password": "pw", "iban": RedactedValue, "user": map[string]interface{}{"1": "x"}}
+	if got := Redact(v, []string{"IBAN", ""}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// an empty list masks only tagged fields
+	if got := Redact(redactDB{Password: "pw"}, []string{}); !reflect.DeepEqual(got, map[string]interface{}{"host": "", "password": "pw"}) {
+		t.Errorf("got %v", got)
+	}
+
+	a := &API{}
+	a.Config.RedactPatterns = []string{"host"}
+	if got := a.Redact(redactDB{Host: "db", Password: "pw"}); !reflect.DeepEqual(got, map[string]interface{}{"host": RedactedValue, "password": "pw"}) {
+		t.Errorf("got %v", got)
+	}
+	for _, v := range []interface{}{nil, (*redactDB)(nil), func() {}, make(chan int)} {
+		if got := Redact(v, nil); got != nil {
+			t.Errorf("%T: got %v", v, got)
+		}
+	}
+}
+
+type redactMarshaler struct{ dsn string }
+
+func (m *redactMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"driver": "pg", "dsn": m.dsn})
+}
+
+func TestRedactMarshalers(t *testing.T) {
+	v := struct {
+		Raw     json.RawMessage `json:"raw"`
+		List    json.RawMessage `json:"list"`
+		Custom  redactMarshaler `json:"custom"`
+		Version json.RawMessage `json:"version"`
+		Secret  json.RawMessage `json:"secret"`
+	}{
+		Raw:     json.RawMessage(`{"user":"u","password":"x"}`),
+		List:    json.RawMessage(`[{"token":"t"},2]`),
+		Custom:  redactMarshaler{dsn: "postgres://u:p@db"},
+		Version: json.RawMessage(`"1.2"`),
+		Secret:  json.RawMessage(`{"a":1}`),
+	}
+	want := map[string]interface{}{
+		"raw":     map[string]interface{}{"user": "u", "password": RedactedValue},
+		"list":    []interface{}{map[string]interface{}{"token": RedactedValue}, int64(2)},
+		"custom":  map[string]interface{}{"driver": "pg", "dsn": RedactedValue},
+		"version": json.RawMessage(`"1.2"`),
+		"secret":  RedactedValue,
+	}
+	if got := Redact(v, nil); !reflect.DeepEqual(got, want) {
+		g, _ := json.Marshal(got)
+		t.Errorf("got %s", g)
+	}
+}
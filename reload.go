@@ -0,0 +1,40 @@
+package go_base_api
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// watchFiles calls reload on SIGHUP and, every interval (if > 0), when
+// changed reports new files on disk, until ctx is done. what names the
+// reloaded files in the logs.
+func watchFiles(ctx context.Context, interval time.Duration, what string, changed func() bool, reload func() error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			Log.Infof("SIGHUP received, reloading %s", what)
+		case <-tick:
+			if !changed() {
+				continue
+			}
+			Log.Infof("%s changed, reloading", what)
+		}
+		if err := reload(); err != nil {
+			Log.Error(err)
+		}
+	}
+}
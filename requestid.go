@@ -0,0 +1,83 @@
+package go_base_api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+type ctxKeyRequestID struct{}
+
+// maxRequestIDLength bounds accepted incoming request IDs.
+const maxRequestIDLength = 128
+
+// NewRequestID returns a random 128-bit hex ID, the default RequestIDGenerator.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		Log.Error("generate request id: ", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of ctx carrying id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyRequestID{}, id)
+}
+
+// RequestIDFrom returns the request ID stored by the RequestID middleware, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID{}).(string)
+	return id
+}
+
+// LoggerFrom returns Log with the request_id field of ctx, if any.
+func LoggerFrom(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(Log)
+	if id := RequestIDFrom(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
+
+// validRequestID accepts short IDs of visible ASCII characters, so a client
+// cannot inject log lines or oversized headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID takes the request ID from RequestIDHeader or generates one with
+// RequestIDGenerator, stores it in the context, echoes it on the response and
+// records it on the current span.
+func (a *API) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := a.Config.RequestIDHeader
+		if header == "" {
+			header = "X-Request-ID"
+		}
+		id := req.Header.Get(header)
+		if !validRequestID(id) {
+			gen := a.RequestIDGenerator
+			if gen == nil {
+				gen = NewRequestID
+			}
+			id = gen()
+		}
+		w.Header().Set(header, id)
+		oteltrace.SpanFromContext(req.Context()).SetAttributes(attribute.String("request_id", id))
+		next.ServeHTTP(w, req.WithContext(WithRequestID(req.Context(), id)))
+	})
+}
@@ -0,0 +1,230 @@
+package go_base_api
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/handlers"
+)
+
+var (
+	ErrServerStarted    = errors.New("server already started")
+	ErrServerNotStarted = errors.New("server not started")
+)
+
+// Start runs the OnStart hooks, binds the listen port (and ManagementPort if
+// set) and serves requests in the background. Hook and listener errors are
+// returned immediately after running the shutdown funcs registered by the
+// hooks that succeeded, so their work is undone. Serve errors are reported
+// by RunContext.
+func (a *API) Start(ctx context.Context) error {
+	undo, err := a.start(ctx)
+	if err != nil && !errors.Is(err, ErrServerStarted) {
+		a.runShutdownFuncs(context.Background(), undo)
+	}
+	return err
+}
+
+// start returns the shutdown funcs registered by the start hooks, Start runs
+// them when it fails.
+func (a *API) start(ctx context.Context) ([]shutdownFunc, error) {
+	a.mu.Lock()
+	started := a.servers != nil
+	a.mu.Unlock()
+	if started {
+		return nil, ErrServerStarted
+	}
+	undo, err := a.runStartHooks(ctx)
+	if err != nil {
+		return undo, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.servers != nil {
+		return nil, ErrServerStarted
+	}
+	servers := []*http.Server{a.newServer(fmt.Sprint(":", a.Config.ListenPort), a.Metrics(handlers.CORS(a.InitializeCORS())(a.Router)))}
+	if a.Config.ManagementPort > 0 {
+		addr := net.JoinHostPort(a.Config.ManagementAddress, fmt.Sprint(a.Config.ManagementPort))
+		servers = append(servers, a.newServer(addr, a.Metrics(a.Management)))
+	}
+	var certs *certReloader
+	if a.Config.TLSEnabled() {
+		cfg, reloader, err := a.tlsConfig()
+		if err != nil {
+			return undo, err
+		}
+		servers[0].TLSConfig = cfg
+		certs = reloader
+	}
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, srv := range servers {
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return undo, fmt.Errorf("listen %s: %w", srv.Addr, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	if certs != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		go certs.watch(ctx, time.Second*time.Duration(a.Config.TLSReloadInterval))
+		a.certs = certs
+		a.stopCerts = cancel
+	}
+	errc := make(chan error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server, ln net.Listener) {
+			defer wg.Done()
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ServeTLS(ln, "", "")
+			} else {
+				err = srv.Serve(ln)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errc <- err
+			}
+		}(srv, listeners[i])
+	}
+	go func() {
+		wg.Wait()
+		close(errc)
+	}()
+	a.servers = servers
+	a.errc = errc
+	a.stopped = make(chan struct{})
+	atomic.StoreInt32(&a.draining, 0)
+	Log.Infof("listening on %s", listeners[0].Addr())
+	if len(listeners) > 1 {
+		Log.Infof("management listening on %s", listeners[1].Addr())
+	}
+	return nil, nil
+}
+
+func (a *API) newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:      handler,
+		Addr:         addr,
+		WriteTimeout: time.Duration(a.Config.WriteTimeout) * time.Second,
+		ReadTimeout:  time.Duration(a.Config.ReadTimeout) * time.Second,
+		IdleTimeout:  time.Second * time.Duration(a.Config.IdleTimeout),
+	}
+}
+
+// Shutdown gracefully stops the servers started by Start. The readiness probe
+// starts failing, after ShutdownDelay active connections are drained within
+// GracefulTimeout (public listener first, then management) and then the
+// registered shutdown funcs run in reverse order. ctx bounds the whole sequence.
+func (a *API) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	servers := a.servers
+	stopped := a.stopped
+	a.servers = nil
+	a.mu.Unlock()
+	if servers == nil {
+		return ErrServerNotStarted
+	}
+	defer close(stopped)
+
+	atomic.StoreInt32(&a.draining, 1)
+	if delay := time.Second * time.Duration(a.Config.ShutdownDelay); delay > 0 {
+		Log.Infof("readiness disabled, waiting %s before draining connections", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	drainCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(a.Config.GracefulTimeout))
+	defer cancel()
+	var err error
+	for _, srv := range servers {
+		if srvErr := srv.Shutdown(drainCtx); srvErr != nil {
+			Log.Errorf("drain connections on %s: %v", srv.Addr, srvErr)
+			if err == nil {
+				err = srvErr
+			}
+		}
+	}
+
+	a.mu.Lock()
+	if a.stopCerts != nil {
+		a.stopCerts()
+		a.stopCerts = nil
+	}
+	a.mu.Unlock()
+
+	a.mu.Lock()
+	funcs := a.shutdownFuncs
+	a.mu.Unlock()
+	if hookErr := a.runShutdownFuncs(ctx, funcs); err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+// RunContext starts the server and blocks until ctx is cancelled, SIGINT or
+// SIGTERM is received, or the server fails. The server is then shut down
+// with Shutdown. When Shutdown is called elsewhere, RunContext returns nil
+// once that shutdown has finished.
+func (a *API) RunContext(ctx context.Context) error {
+	if err := a.Start(ctx); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	errc, stopped := a.errc, a.stopped
+	a.mu.Unlock()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var serveErr error
+	select {
+	case err, ok := <-errc:
+		if !ok {
+			<-stopped
+			return nil
+		}
+		serveErr = err
+	case <-ctx.Done():
+	}
+
+	Log.Info("shutting down")
+	err := a.Shutdown(context.Background())
+	if errors.Is(err, ErrServerNotStarted) {
+		// a concurrent Shutdown got there first
+		<-stopped
+		err = nil
+	}
+	if serveErr != nil {
+		return serveErr
+	}
+	return err
+}
+
+// Run is kept for compatibility: it reads the graceful-timeout flag and runs
+// the server until SIGINT or SIGTERM. Use RunContext to embed the server.
+func (a *API) Run() {
+	wait := time.Second * time.Duration(a.Config.GracefulTimeout)
+	flag.DurationVar(&wait, "graceful-timeout", wait, "the duration for which the server gracefully wait for existing connections to finish - e.g. 15s or 1m")
+	flag.Parse()
+	a.Config.GracefulTimeout = int(wait / time.Second)
+	if err := a.RunContext(context.Background()); err != nil {
+		Log.Error(err)
+	}
+}
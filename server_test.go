@@ -0,0 +1,159 @@
+package go_base_api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestServer(shutdowns *int32) *API {
+	a := &API{Router: mux.NewRouter()}
+	a.Config.GracefulTimeout = 1
+	a.OnShutdown(func(context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(shutdowns, 1)
+		return nil
+	})
+	return a
+}
+
+func waitStarted(t *testing.T, a *API) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		a.mu.Lock()
+		started := a.servers != nil
+		a.mu.Unlock()
+		if started {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server not started")
+}
+
+func TestRunContext(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(a *API, cancel context.CancelFunc) error
+	}{
+		{"context cancelled", func(_ *API, cancel context.CancelFunc) error {
+			cancel()
+			return nil
+		}},
+		{"shutdown elsewhere", func(a *API, _ context.CancelFunc) error {
+			return a.Shutdown(context.Background())
+		}},
+		{"shutdown elsewhere and context cancelled", func(a *API, cancel context.CancelFunc) error {
+			defer cancel()
+			return a.Shutdown(context.Background())
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var shutdowns int32
+			a := newTestServer(&shutdowns)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- a.RunContext(ctx) }()
+			waitStarted(t, a)
+			if err := tt.stop(a, cancel); err != nil {
+				t.Errorf("stop: %v", err)
+			}
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("RunContext: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("RunContext did not return")
+			}
+			if n := atomic.LoadInt32(&shutdowns); n != 1 {
+				t.Errorf("shutdown funcs ran %d times, want 1", n)
+			}
+			if err := a.Shutdown(context.Background()); !errors.Is(err, ErrServerNotStarted) {
+				t.Errorf("second Shutdown: %v", err)
+			}
+		})
+	}
+}
+
+func TestStartShutdown(t *testing.T) {
+	var shutdowns int32
+	a := newTestServer(&shutdowns)
+	if err := a.Shutdown(context.Background()); !errors.Is(err, ErrServerNotStarted) {
+		t.Errorf("Shutdown before Start: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Start(context.Background()); !errors.Is(err, ErrServerStarted) {
+		t.Errorf("second Start: %v", err)
+	}
+	if a.Draining() {
+		t.Error("draining after Start")
+	}
+	if err := a.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Draining() || atomic.LoadInt32(&shutdowns) != 1 {
+		t.Errorf("draining %v, shutdown funcs ran %d times", a.Draining(), shutdowns)
+	}
+}
+
+func TestStartUnwind(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name   string
+		fail   bool
+		port   int
+		undone []string
+	}{
+		{"hook fails", true, 0, []string{"first"}},
+		{"listen fails", false, port, []string{"second", "first"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var undone []string
+			undo := func(name string) Hook {
+				return func(context.Context) error {
+					undone = append(undone, name)
+					return nil
+				}
+			}
+			a := &API{Router: mux.NewRouter()}
+			a.Config.ListenPort = tt.port
+			a.RegisterShutdown("initialize", 0, undo("initialize"))
+			a.OnStart(func(context.Context) error {
+				a.RegisterShutdown("first", 0, undo("first"))
+				return nil
+			})
+			a.OnStart(func(context.Context) error {
+				a.RegisterShutdown("second", 0, undo("second"))
+				if tt.fail {
+					return errors.New("boom")
+				}
+				return nil
+			})
+			if err := a.Start(context.Background()); err == nil {
+				a.Shutdown(context.Background())
+				t.Fatal("Start succeeded")
+			}
+			if !reflect.DeepEqual(undone, tt.undone) {
+				t.Errorf("undone %v, want %v", undone, tt.undone)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package go_base_api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ctxKeyPeerIdentity struct{}
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	tlsClientAuthTypes = map[string]tls.ClientAuthType{
+		"none":               tls.NoClientCert,
+		"request":            tls.RequestClientCert,
+		"require":            tls.RequireAnyClientCert,
+		"verify_if_given":    tls.VerifyClientCertIfGiven,
+		"require_and_verify": tls.RequireAndVerifyClientCert,
+	}
+)
+
+// PeerIdentity describes the verified client certificate of a mutual-TLS request.
+type PeerIdentity struct {
+	CommonName     string    `json:"common_name"`
+	Organization   []string  `json:"organization,omitempty"`
+	DNSNames       []string  `json:"dns_names,omitempty"`
+	EmailAddresses []string  `json:"email_addresses,omitempty"`
+	URIs           []string  `json:"uris,omitempty"`
+	SerialNumber   string    `json:"serial_number"`
+	Issuer         string    `json:"issuer"`
+	NotAfter       time.Time `json:"not_after"`
+}
+
+func newPeerIdentity(cert *x509.Certificate) *PeerIdentity {
+	uris := make([]string, 0, len(cert.URIs))
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+	return &PeerIdentity{
+		CommonName:     cert.Subject.CommonName,
+		Organization:   cert.Subject.Organization,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           uris,
+		SerialNumber:   cert.SerialNumber.String(),
+		Issuer:         cert.Issuer.String(),
+		NotAfter:       cert.NotAfter,
+	}
+}
+
+// PeerIdentityFrom returns the verified client certificate identity stored by the PeerIdentity middleware.
+func PeerIdentityFrom(ctx context.Context) (*PeerIdentity, bool) {
+	p, ok := ctx.Value(ctxKeyPeerIdentity{}).(*PeerIdentity)
+	return p, ok
+}
+
+// PeerIdentity puts the verified client certificate of the connection into the request context.
+func (a *API) PeerIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+			p := newPeerIdentity(req.TLS.VerifiedChains[0][0])
+			req = req.WithContext(context.WithValue(req.Context(), ctxKeyPeerIdentity{}, p))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// TLSEnabled reports whether the server must be served over TLS.
+func (con *ApiServerConfig) TLSEnabled() bool {
+	return con.TLSCertFile != "" && con.TLSKeyFile != ""
+}
+
+func (a *API) tlsConfig() (*tls.Config, *certReloader, error) {
+	var metrics *certMetrics
+	if a.Config.Prometheus {
+		metrics = newCertMetrics(a.registerCollector)
+	}
+	certs, err := newCertReloader(a.Config.TLSCertFile, a.Config.TLSKeyFile, metrics)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := &tls.Config{GetCertificate: certs.GetCertificate}
+
+	minVersion, ok := tlsVersions[a.Config.TLSMinVersion]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown tls_min_version %q", a.Config.TLSMinVersion)
+	}
+	cfg.MinVersion = minVersion
+
+	if len(a.Config.TLSCipherSuites) > 0 {
+		suites := map[string]uint16{}
+		for _, s := range tls.CipherSuites() {
+			suites[s.Name] = s.ID
+		}
+		for _, name := range a.Config.TLSCipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown or insecure tls cipher suite %q", name)
+			}
+			cfg.CipherSuites = append(cfg.CipherSuites, id)
+		}
+	}
+
+	clientAuth := strings.ToLower(a.Config.TLSClientAuth)
+	if clientAuth == "" && a.Config.TLSClientCAFile != "" {
+		clientAuth = "require_and_verify"
+	}
+	if clientAuth != "" {
+		authType, ok := tlsClientAuthTypes[clientAuth]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown tls_client_auth %q", a.Config.TLSClientAuth)
+		}
+		cfg.ClientAuth = authType
+	}
+	if a.Config.TLSClientCAFile != "" {
+		pem, err := ioutil.ReadFile(a.Config.TLSClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read tls client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", a.Config.TLSClientCAFile)
+		}
+		cfg.ClientCAs = pool
+	} else if cfg.ClientAuth == tls.VerifyClientCertIfGiven || cfg.ClientAuth == tls.RequireAndVerifyClientCert {
+		return nil, nil, fmt.Errorf("tls_client_auth %q requires tls_client_ca_file", clientAuth)
+	}
+	return cfg, certs, nil
+}
@@ -0,0 +1,140 @@
+package go_base_api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CertificateStatus is the outcome of the last server certificate reload.
+type CertificateStatus struct {
+	Subject    string    `json:"subject"`
+	NotAfter   time.Time `json:"not_after"`
+	LastReload time.Time `json:"last_reload"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+type certMetrics struct {
+	expiry  prometheus.Gauge
+	reloads *prometheus.CounterVec
+}
+
+func newCertMetrics(register func(prometheus.Collector) prometheus.Collector) *certMetrics {
+	return &certMetrics{
+		expiry: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tls_certificate_expiry_timestamp_seconds",
+			Help: "Expiry time of the served TLS certificate in unix seconds",
+		})).(prometheus.Gauge),
+		reloads: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tls_certificate_reloads_total",
+			Help: "The total number of TLS certificate reloads by result",
+		}, []string{"result"})).(*prometheus.CounterVec),
+	}
+}
+
+// certReloader serves the current key pair through tls.Config.GetCertificate
+// and swaps it when the files change or SIGHUP is received.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	metrics  *certMetrics
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	status   CertificateStatus
+}
+
+func newCertReloader(certFile, keyFile string, metrics *certMetrics) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile, metrics: metrics}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Reload loads the key pair from disk. On failure the previous certificate is kept.
+func (c *certReloader) Reload() error {
+	modTimes := c.fileModTimes()
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.modTimes = modTimes
+	c.status.LastReload = time.Now()
+	if err != nil {
+		err = fmt.Errorf("load tls key pair: %w", err)
+		c.status.LastError = err.Error()
+		if c.metrics != nil {
+			c.metrics.reloads.WithLabelValues("error").Inc()
+		}
+		return err
+	}
+	c.cert = &cert
+	c.status.LastError = ""
+	c.status.Subject = cert.Leaf.Subject.String()
+	c.status.NotAfter = cert.Leaf.NotAfter
+	if c.metrics != nil {
+		c.metrics.reloads.WithLabelValues("success").Inc()
+		c.metrics.expiry.Set(float64(cert.Leaf.NotAfter.Unix()))
+	}
+	return nil
+}
+
+func (c *certReloader) Status() CertificateStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
+}
+
+func (c *certReloader) fileModTimes() (t [2]time.Time) {
+	for i, f := range []string{c.certFile, c.keyFile} {
+		if fi, err := os.Stat(f); err == nil {
+			t[i] = fi.ModTime()
+		}
+	}
+	return t
+}
+
+func (c *certReloader) changed() bool {
+	modTimes := c.fileModTimes()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return modTimes != c.modTimes
+}
+
+// watch polls the files every interval (if > 0) and reloads on SIGHUP until ctx is done.
+func (c *certReloader) watch(ctx context.Context, interval time.Duration) {
+	watchFiles(ctx, interval, "tls certificate", c.changed, func() error {
+		if err := c.Reload(); err != nil {
+			return err
+		}
+		Log.Infof("tls certificate reloaded, expires %s", c.Status().NotAfter)
+		return nil
+	})
+}
+
+// CertificateStatus returns the state of the served TLS certificate, false if TLS is not running.
+func (a *API) CertificateStatus() (CertificateStatus, bool) {
+	a.mu.Lock()
+	certs := a.certs
+	a.mu.Unlock()
+	if certs == nil {
+		return CertificateStatus{}, false
+	}
+	return certs.Status(), true
+}
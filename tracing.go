@@ -0,0 +1,52 @@
+package go_base_api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// TracingConfig enables OpenTelemetry server spans for routed requests.
+// Ignore lists path prefixes or route names that get no span.
+type TracingConfig struct {
+	Enabled bool     `json:"enabled" yaml:"enabled"`
+	Ignore  []string `json:"ignore" yaml:"ignore"`
+}
+
+// Propagator is the W3C trace-context and baggage propagator used to extract
+// the parent span of incoming requests.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{}, propagation.Baggage{})
+
+// Tracing starts a server span per request, named after the method and the
+// route template, continuing the trace from traceparent/baggage headers. The
+// span records the status code, request and response sizes.
+func (a *API) Tracing(next http.Handler) http.Handler {
+	route := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if tpl := routeTemplate(req); tpl != "" {
+			oteltrace.SpanFromContext(req.Context()).SetAttributes(semconv.HTTPRouteKey.String(tpl))
+		}
+		next.ServeHTTP(w, req)
+	})
+	return otelhttp.NewHandler(route, a.Config.App,
+		otelhttp.WithPropagators(Propagator),
+		otelhttp.WithSpanNameFormatter(func(operation string, req *http.Request) string {
+			if tpl := routeTemplate(req); tpl != "" {
+				return req.Method + " " + tpl
+			}
+			return req.Method + " " + operation
+		}),
+		otelhttp.WithFilter(func(req *http.Request) bool {
+			name := ""
+			if r := mux.CurrentRoute(req); r != nil {
+				name = r.GetName()
+			}
+			_, ignored := matchRoute(a.Config.Tracing.Ignore, req.URL.Path, name)
+			return !ignored
+		}),
+	)
+}
@@ -0,0 +1,171 @@
+package go_base_api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// validateRequest checks `validate` struct tags of *v, then calls Validator if implemented.
+// Supported rules: required, omitempty, min=N, max=N, len=N (value for numbers,
+// length for strings, slices and maps) and oneof=a b c.
+func validateRequest(v interface{}) error {
+	// the outermost non-nil level implementing Validator is used, so a
+	// pointer receiver works for both Req T and Req *T
+	var validator Validator
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		if val, ok := rv.Interface().(Validator); ok && validator == nil {
+			validator = val
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		var fields []FieldError
+		validateStruct(rv, "", &fields)
+		if len(fields) > 0 {
+			return NewValidationError(fields...)
+		}
+	}
+	if val, ok := rv.Interface().(Validator); ok && validator == nil && rv.Kind() != reflect.Ptr {
+		validator = val
+	}
+	if validator != nil {
+		return validationError(validator.Validate())
+	}
+	return nil
+}
+
+// validationError turns a plain error from Validator into a 422. APIErrors and
+// wrapped sentinel errors keep their status.
+func validationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) || toAPIError(err).Status != http.StatusInternalServerError {
+		return err
+	}
+	return &APIError{Status: http.StatusUnprocessableEntity, Detail: err.Error(), Err: fmt.Errorf("%w: %v", ErrValidation, err)}
+}
+
+func validateStruct(v reflect.Value, prefix string, fields *[]FieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && fv.Kind() == reflect.Struct {
+			validateStruct(fv, prefix, fields)
+			continue
+		}
+		name := prefix + fieldName(f)
+		if rules := f.Tag.Get("validate"); rules != "" && rules != "-" {
+			if msg := validateField(fv, rules); msg != "" {
+				*fields = append(*fields, FieldError{Field: name, Message: msg})
+				continue
+			}
+		}
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			validateStruct(fv, name+".", fields)
+		}
+	}
+}
+
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "path", "query", "header"} {
+		if name := strings.Split(f.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func validateField(v reflect.Value, rules string) string {
+	if v.IsZero() {
+		for _, rule := range strings.Split(rules, ",") {
+			switch rule {
+			case "required":
+				return "is required"
+			case "omitempty":
+				return ""
+			}
+		}
+		if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			return ""
+		}
+	}
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required", "omitempty", "":
+		case "min", "max", "len":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Sprintf("invalid rule %q", rule)
+			}
+			size, isLen := measure(v)
+			what := ""
+			if isLen {
+				what = "length "
+			}
+			switch {
+			case name == "min" && size < limit:
+				return fmt.Sprintf("%smust be at least %s", what, arg)
+			case name == "max" && size > limit:
+				return fmt.Sprintf("%smust be at most %s", what, arg)
+			case name == "len" && size != limit:
+				return fmt.Sprintf("%smust be %s", what, arg)
+			}
+		case "oneof":
+			s := fmt.Sprint(v.Interface())
+			ok := false
+			for _, opt := range strings.Fields(arg) {
+				if s == opt {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				return fmt.Sprintf("must be one of [%s]", arg)
+			}
+		default:
+			return fmt.Sprintf("unknown rule %q", name)
+		}
+	}
+	return ""
+}
+
+// measure returns the numeric value of v, or its length and true for strings, slices and maps.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false
+	}
+	return 0, false
+}